@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"github.com/alenapetraki/chat/api/grpc/chatpb"
+	"github.com/alenapetraki/chat/entities"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newChat(chat *entities.Chat) *chatpb.Chat {
+	return &chatpb.Chat{
+		Id:          chat.ID,
+		Type:        string(chat.Type),
+		Name:        chat.Name,
+		NumMembers:  int32(chat.NumMembers),
+		Description: chat.Description,
+		AvatarUrl:   chat.AvatarURL,
+	}
+}
+
+func newEvent(e *entities.Event) *chatpb.Event {
+	event := &chatpb.Event{
+		Type:      string(e.Type),
+		ChatId:    e.ChatID,
+		UserId:    e.UserID,
+		Role:      string(e.Role),
+		CreatedAt: timestamppb.New(e.CreatedAt),
+	}
+	if e.Chat != nil {
+		event.Chat = newChat(e.Chat)
+	}
+	if e.Message != nil {
+		event.Message = newMessage(e.Message)
+	}
+	return event
+}
+
+func newMessage(msg *entities.Message) *chatpb.Message {
+	res := &chatpb.Message{
+		Id:        msg.ID,
+		UserId:    msg.UserID,
+		Body:      msg.Body,
+		CreatedAt: timestamppb.New(msg.CreatedAt),
+	}
+	if msg.EditedAt != nil {
+		res.EditedAt = timestamppb.New(*msg.EditedAt)
+	}
+	return res
+}
+
+func newRevision(rev *entities.MessageRevision) *chatpb.MessageRevision {
+	return &chatpb.MessageRevision{
+		EditorId:  rev.EditorID,
+		Body:      rev.Body,
+		CreatedAt: timestamppb.New(rev.CreatedAt),
+	}
+}
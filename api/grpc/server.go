@@ -0,0 +1,258 @@
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative chatpb/chats.proto
+
+import (
+	"context"
+
+	"github.com/alenapetraki/chat/api/grpc/chatpb"
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/services/events/hub"
+	"github.com/alenapetraki/chat/services/messages"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Number of events buffered per stream before it is considered slow and closed.
+const sendBufferSize = 256
+
+// Server implements chatpb.ChatsServer and chatpb.MessagesServer on top of the chats
+// and messages services.
+type Server struct {
+	chatpb.UnimplementedChatsServer
+	chatpb.UnimplementedMessagesServer
+
+	chats       chats.Chats
+	messages    messages.Messages
+	hub         *hub.Hub
+	memberships chats.Memberships
+}
+
+func NewServer(chats chats.Chats, messages messages.Messages, hub *hub.Hub, memberships chats.Memberships) *Server {
+	return &Server{chats: chats, messages: messages, hub: hub, memberships: memberships}
+}
+
+// NewGRPCServer returns a gRPC server with the chats and messages services registered. Callers are
+// authenticated by bearer tokens in the "authorization" metadata key, see auth.UnaryServerInterceptor.
+func NewGRPCServer(srv *Server, verifier auth.Verifier, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(verifier)),
+		grpc.ChainStreamInterceptor(auth.StreamServerInterceptor(verifier)),
+	}, opts...)
+	s := grpc.NewServer(opts...)
+	chatpb.RegisterChatsServer(s, srv)
+	chatpb.RegisterMessagesServer(s, srv)
+	return s
+}
+
+// statusError converts a service error to a status, see errs.GRPCStatus.
+func statusError(err error) error {
+	return errs.GRPCStatus(err).Err()
+}
+
+func (s *Server) CreateChat(ctx context.Context, req *chatpb.CreateChatRequest) (*chatpb.Chat, error) {
+	chat, err := s.chats.CreateChat(ctx, &entities.Chat{
+		Type:        entities.ChatType(req.Type),
+		Name:        req.Name,
+		Description: req.Description,
+		AvatarURL:   req.AvatarUrl,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newChat(chat), nil
+}
+
+func (s *Server) GetChat(ctx context.Context, req *chatpb.GetChatRequest) (*chatpb.Chat, error) {
+	chat, err := s.chats.GetChat(ctx, req.ChatId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newChat(chat), nil
+}
+
+func (s *Server) UpdateChat(ctx context.Context, req *chatpb.UpdateChatRequest) (*chatpb.Chat, error) {
+	chat, err := s.chats.UpdateChat(ctx, req.ChatId, &chats.ChatUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		AvatarURL:   req.AvatarUrl,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newChat(chat), nil
+}
+
+func (s *Server) DeleteChat(ctx context.Context, req *chatpb.DeleteChatRequest) (*emptypb.Empty, error) {
+	if err := s.chats.DeleteChat(ctx, req.ChatId); err != nil {
+		return nil, statusError(err)
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (s *Server) SetMember(ctx context.Context, req *chatpb.SetMemberRequest) (*emptypb.Empty, error) {
+	if req.Role == "" {
+		return nil, statusError(errs.Invalid("role", "cannot be blank"))
+	}
+	if err := s.chats.SetMember(ctx, req.ChatId, req.UserId, entities.Role(req.Role)); err != nil {
+		return nil, statusError(err)
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (s *Server) DeleteMember(ctx context.Context, req *chatpb.DeleteMemberRequest) (*emptypb.Empty, error) {
+	if err := s.chats.DeleteMember(ctx, req.ChatId, req.UserId); err != nil {
+		return nil, statusError(err)
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (s *Server) GetRole(ctx context.Context, req *chatpb.GetRoleRequest) (*chatpb.GetRoleResponse, error) {
+	role, err := s.chats.GetRole(ctx, req.ChatId, req.UserId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &chatpb.GetRoleResponse{Role: string(role)}, nil
+}
+
+func (s *Server) FindChatMembers(ctx context.Context, req *chatpb.FindChatMembersRequest) (*chatpb.FindChatMembersResponse, error) {
+	filter := &chats.FindChatMembersFilter{}
+	for _, role := range req.Roles {
+		filter.Roles = append(filter.Roles, entities.Role(role))
+	}
+	options := &util.PaginationOptions{
+		Limit:  uint(req.Limit),
+		Offset: uint(req.Offset),
+		Cursor: req.Cursor,
+	}
+
+	members, page, err := s.chats.FindChatMembers(ctx, req.ChatId, filter, options)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &chatpb.FindChatMembersResponse{Members: make([]*chatpb.ChatMember, len(members))}
+	if page != nil {
+		resp.NextCursor, resp.PrevCursor = page.NextCursor, page.PrevCursor
+	}
+	for i, m := range members {
+		resp.Members[i] = &chatpb.ChatMember{UserId: m.UserID, Role: string(m.Role)}
+		if m.User != nil {
+			resp.Members[i].User = &chatpb.User{
+				Id:       m.User.ID,
+				Username: m.User.Username,
+				FullName: m.User.FullName,
+				Status:   m.User.Status,
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) SendMessage(ctx context.Context, req *chatpb.SendMessageRequest) (*chatpb.Message, error) {
+	msg, err := s.messages.SendMessage(ctx, req.ChatId, req.Body)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newMessage(msg), nil
+}
+
+func (s *Server) GetMessage(ctx context.Context, req *chatpb.GetMessageRequest) (*chatpb.Message, error) {
+	msg, err := s.messages.GetMessage(ctx, req.ChatId, req.MessageId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newMessage(msg), nil
+}
+
+func (s *Server) ListMessages(ctx context.Context, req *chatpb.ListMessagesRequest) (*chatpb.ListMessagesResponse, error) {
+	options := &util.PaginationOptions{
+		Limit:  uint(req.Limit),
+		Offset: uint(req.Offset),
+		Cursor: req.Cursor,
+	}
+
+	msgs, page, err := s.messages.ListMessages(ctx, req.ChatId, options)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &chatpb.ListMessagesResponse{Messages: make([]*chatpb.Message, len(msgs))}
+	if page != nil {
+		resp.NextCursor, resp.PrevCursor = page.NextCursor, page.PrevCursor
+	}
+	for i, msg := range msgs {
+		resp.Messages[i] = newMessage(msg)
+	}
+	return resp, nil
+}
+
+func (s *Server) EditMessage(ctx context.Context, req *chatpb.EditMessageRequest) (*chatpb.Message, error) {
+	msg, err := s.messages.EditMessage(ctx, req.ChatId, req.MessageId, req.Body)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newMessage(msg), nil
+}
+
+func (s *Server) DeleteMessage(ctx context.Context, req *chatpb.DeleteMessageRequest) (*emptypb.Empty, error) {
+	if err := s.messages.DeleteMessage(ctx, req.ChatId, req.MessageId); err != nil {
+		return nil, statusError(err)
+	}
+	return new(emptypb.Empty), nil
+}
+
+func (s *Server) ListRevisions(ctx context.Context, req *chatpb.ListRevisionsRequest) (*chatpb.ListRevisionsResponse, error) {
+	revs, err := s.messages.ListRevisions(ctx, req.ChatId, req.MessageId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &chatpb.ListRevisionsResponse{Revisions: make([]*chatpb.MessageRevision, len(revs))}
+	for i, rev := range revs {
+		resp.Revisions[i] = newRevision(rev)
+	}
+	return resp, nil
+}
+
+func (s *Server) StreamEvents(_ *chatpb.StreamEventsRequest, stream chatpb.Chats_StreamEventsServer) error {
+	ctx := stream.Context()
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return statusError(err)
+	}
+
+	chatIDs, err := s.memberships.FindMemberChatIDs(ctx, userID)
+	if err != nil {
+		return statusError(err)
+	}
+
+	sub := s.hub.Subscribe(userID, chatIDs, sendBufferSize)
+	defer sub.Close()
+
+	// Headers are sent once the user is subscribed, so that clients
+	// may wait for them not to miss events published afterwards.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event := <-sub.Events():
+			if err := stream.Send(newEvent(event)); err != nil {
+				return err
+			}
+		case <-sub.Done():
+			return status.Error(codes.ResourceExhausted, "subscription closed")
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/api/grpc/chatpb"
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/services/events/hub"
+	"github.com/alenapetraki/chat/services/messages"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type chatsStub struct {
+	chats.Chats
+	chat *entities.Chat
+	err  error
+
+	userID  string
+	filter  *chats.FindChatMembersFilter
+	options *util.PaginationOptions
+}
+
+func (s *chatsStub) CreateChat(ctx context.Context, chat *entities.Chat) (*entities.Chat, error) {
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.userID = userID
+	chat.ID = "chat_1"
+	chat.NumMembers = 1
+	s.chat = chat
+	return chat, nil
+}
+
+func (s *chatsStub) GetChat(_ context.Context, _ string) (*entities.Chat, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.chat, nil
+}
+
+func (s *chatsStub) UpdateChat(_ context.Context, _ string, update *chats.ChatUpdate) (*entities.Chat, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	update.Apply(s.chat)
+	return s.chat, nil
+}
+
+func (s *chatsStub) SetMember(_ context.Context, _, _ string, _ entities.Role) error {
+	return s.err
+}
+
+func (s *chatsStub) FindChatMembers(_ context.Context, _ string, filter *chats.FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error) {
+	s.filter, s.options = filter, options
+	members := []*entities.ChatMember{
+		{UserID: "user_1", Role: entities.RoleOwner, User: &entities.User{ID: "user_1", Username: "alice"}},
+		{UserID: "user_2", Role: entities.RoleMember},
+	}
+	return members, &util.Page{NextCursor: "next"}, s.err
+}
+
+type messagesStub struct {
+	messages.Messages
+	err error
+
+	chatID    string
+	messageID string
+	options   *util.PaginationOptions
+}
+
+func (s *messagesStub) SendMessage(ctx context.Context, chatID, body string) (*entities.Message, error) {
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.chatID = chatID
+	return &entities.Message{ID: "msg_1", UserID: userID, Body: body, CreatedAt: time.Now()}, nil
+}
+
+func (s *messagesStub) ListMessages(_ context.Context, chatID string, options *util.PaginationOptions) ([]*entities.Message, *util.Page, error) {
+	s.chatID, s.options = chatID, options
+	edited := time.Now()
+	msgs := []*entities.Message{
+		{ID: "msg_2", UserID: "user_2", Body: "edited", EditedAt: &edited},
+		{ID: "msg_1", UserID: "user_1", Body: "hello"},
+	}
+	return msgs, &util.Page{NextCursor: "next", PrevCursor: "prev"}, s.err
+}
+
+func (s *messagesStub) GetMessage(_ context.Context, chatID, messageID string) (*entities.Message, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.chatID, s.messageID = chatID, messageID
+	return &entities.Message{ID: messageID, UserID: "user_2", Body: "hello"}, nil
+}
+
+func (s *messagesStub) EditMessage(ctx context.Context, chatID, messageID, body string) (*entities.Message, error) {
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.chatID, s.messageID = chatID, messageID
+	edited := time.Now()
+	return &entities.Message{ID: messageID, UserID: userID, Body: body, EditedAt: &edited}, nil
+}
+
+func (s *messagesStub) DeleteMessage(_ context.Context, chatID, messageID string) error {
+	s.chatID, s.messageID = chatID, messageID
+	return s.err
+}
+
+func (s *messagesStub) ListRevisions(_ context.Context, chatID, messageID string) ([]*entities.MessageRevision, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.chatID, s.messageID = chatID, messageID
+	return []*entities.MessageRevision{
+		{MessageID: messageID, EditorID: "user_1", Body: "hello", CreatedAt: time.Now()},
+		{MessageID: messageID, EditorID: "user_1", Body: "edited", CreatedAt: time.Now()},
+	}, nil
+}
+
+type membershipsStub []string
+
+func (s membershipsStub) FindMemberChatIDs(_ context.Context, _ string) ([]string, error) {
+	return s, nil
+}
+
+// serve starts the server in memory and returns a client authenticated as user_1.
+func serve(t *testing.T, stub *chatsStub, h *hub.Hub) (chatpb.ChatsClient, context.Context) {
+	conn, ctx := dial(t, NewServer(stub, nil, h, membershipsStub{"chat_1"}))
+	return chatpb.NewChatsClient(conn), ctx
+}
+
+// serveMessages is serve for the messages service.
+func serveMessages(t *testing.T, stub *messagesStub) (chatpb.MessagesClient, context.Context) {
+	conn, ctx := dial(t, NewServer(nil, stub, hub.New(), membershipsStub{"chat_1"}))
+	return chatpb.NewMessagesClient(conn), ctx
+}
+
+func dial(t *testing.T, server *Server) (*grpc.ClientConn, context.Context) {
+	tokens, err := auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	require.NoError(t, err)
+	srv := NewGRPCServer(server, tokens)
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	token, err := tokens.Issue(&entities.User{ID: "user_1"})
+	require.NoError(t, err)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	return conn, ctx
+}
+
+func TestCreateChat(t *testing.T) {
+
+	stub := &chatsStub{}
+	client, ctx := serve(t, stub, hub.New())
+
+	chat, err := client.CreateChat(ctx, &chatpb.CreateChatRequest{Type: "group", Name: "group one"})
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", chat.Id)
+	assert.Equal(t, "group one", chat.Name)
+	assert.EqualValues(t, 1, chat.NumMembers)
+	assert.Equal(t, "user_1", stub.userID, "chat must be created on behalf of the token user")
+
+	_, err = client.CreateChat(context.Background(), &chatpb.CreateChatRequest{Type: "group", Name: "group one"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "anonymous calls are rejected by the service")
+
+	bad := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid")
+	_, err = client.CreateChat(bad, &chatpb.CreateChatRequest{Type: "group", Name: "group one"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestUpdateChat(t *testing.T) {
+
+	stub := &chatsStub{chat: &entities.Chat{ID: "chat_1", Type: entities.GroupType, Name: "group", Description: "descr"}}
+	client, ctx := serve(t, stub, hub.New())
+
+	chat, err := client.UpdateChat(ctx, &chatpb.UpdateChatRequest{ChatId: "chat_1", Name: proto.String("new name")})
+	require.NoError(t, err)
+	assert.Equal(t, "new name", chat.Name)
+	assert.Equal(t, "descr", chat.Description, "omitted fields must stay unchanged")
+}
+
+func TestFindChatMembers(t *testing.T) {
+
+	stub := &chatsStub{}
+	client, ctx := serve(t, stub, hub.New())
+
+	resp, err := client.FindChatMembers(ctx, &chatpb.FindChatMembersRequest{ChatId: "chat_1", Roles: []string{"owner", "member"}, Limit: 5, Cursor: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, &chats.FindChatMembersFilter{Roles: []entities.Role{entities.RoleOwner, entities.RoleMember}}, stub.filter)
+	assert.Equal(t, &util.PaginationOptions{Limit: 5, Cursor: "abc"}, stub.options)
+	assert.Equal(t, "next", resp.NextCursor)
+	require.Len(t, resp.Members, 2)
+	assert.Equal(t, "alice", resp.Members[0].User.GetUsername())
+	assert.Nil(t, resp.Members[1].User)
+}
+
+func TestSendMessage(t *testing.T) {
+
+	stub := &messagesStub{}
+	client, ctx := serveMessages(t, stub)
+
+	msg, err := client.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: "chat_1", Body: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", stub.chatID)
+	assert.Equal(t, "msg_1", msg.Id)
+	assert.Equal(t, "user_1", msg.UserId, "message must be sent on behalf of the token user")
+	assert.Equal(t, "hello", msg.Body)
+	assert.Nil(t, msg.EditedAt)
+
+	_, err = client.SendMessage(context.Background(), &chatpb.SendMessageRequest{ChatId: "chat_1", Body: "hello"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	client, ctx = serveMessages(t, &messagesStub{err: errors.Wrap(messages.ErrNotMember, "op")})
+	_, err = client.SendMessage(ctx, &chatpb.SendMessageRequest{ChatId: "chat_1", Body: "hello"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestListMessages(t *testing.T) {
+
+	stub := &messagesStub{}
+	client, ctx := serveMessages(t, stub)
+
+	resp, err := client.ListMessages(ctx, &chatpb.ListMessagesRequest{ChatId: "chat_1", Limit: 2, Cursor: "abc"})
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", stub.chatID)
+	assert.Equal(t, &util.PaginationOptions{Limit: 2, Cursor: "abc"}, stub.options)
+	assert.Equal(t, "next", resp.NextCursor)
+	assert.Equal(t, "prev", resp.PrevCursor)
+	require.Len(t, resp.Messages, 2)
+	assert.Equal(t, "msg_2", resp.Messages[0].Id)
+	assert.NotNil(t, resp.Messages[0].EditedAt)
+	assert.Nil(t, resp.Messages[1].EditedAt)
+
+	client, ctx = serveMessages(t, &messagesStub{err: errors.Wrap(util.ErrInvalidCursor, "op")})
+	_, err = client.ListMessages(ctx, &chatpb.ListMessagesRequest{ChatId: "chat_1", Cursor: "garbage"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetMessage(t *testing.T) {
+
+	stub := &messagesStub{}
+	client, ctx := serveMessages(t, stub)
+
+	msg, err := client.GetMessage(ctx, &chatpb.GetMessageRequest{ChatId: "chat_1", MessageId: "msg_1"})
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", stub.chatID)
+	assert.Equal(t, "msg_1", msg.Id)
+	assert.Equal(t, "hello", msg.Body)
+
+	client, ctx = serveMessages(t, &messagesStub{err: errors.Wrap(messages.ErrNotFound, "op")})
+	_, err = client.GetMessage(ctx, &chatpb.GetMessageRequest{ChatId: "chat_1", MessageId: "msg_1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestEditMessage(t *testing.T) {
+
+	stub := &messagesStub{}
+	client, ctx := serveMessages(t, stub)
+
+	msg, err := client.EditMessage(ctx, &chatpb.EditMessageRequest{ChatId: "chat_1", MessageId: "msg_1", Body: "edited"})
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", stub.chatID)
+	assert.Equal(t, "msg_1", stub.messageID)
+	assert.Equal(t, "user_1", msg.UserId, "message must be edited on behalf of the token user")
+	assert.Equal(t, "edited", msg.Body)
+	assert.NotNil(t, msg.EditedAt)
+
+	client, ctx = serveMessages(t, &messagesStub{err: errors.Wrap(messages.ErrForbidden, "op")})
+	_, err = client.EditMessage(ctx, &chatpb.EditMessageRequest{ChatId: "chat_1", MessageId: "msg_1", Body: "edited"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestDeleteMessage(t *testing.T) {
+
+	stub := &messagesStub{}
+	client, ctx := serveMessages(t, stub)
+
+	_, err := client.DeleteMessage(ctx, &chatpb.DeleteMessageRequest{ChatId: "chat_1", MessageId: "msg_1"})
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", stub.chatID)
+	assert.Equal(t, "msg_1", stub.messageID)
+
+	client, ctx = serveMessages(t, &messagesStub{err: errors.Wrap(messages.ErrForbidden, "op")})
+	_, err = client.DeleteMessage(ctx, &chatpb.DeleteMessageRequest{ChatId: "chat_1", MessageId: "msg_1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestListRevisions(t *testing.T) {
+
+	stub := &messagesStub{}
+	client, ctx := serveMessages(t, stub)
+
+	resp, err := client.ListRevisions(ctx, &chatpb.ListRevisionsRequest{ChatId: "chat_1", MessageId: "msg_1"})
+	require.NoError(t, err)
+	assert.Equal(t, "msg_1", stub.messageID)
+	require.Len(t, resp.Revisions, 2)
+	assert.Equal(t, "hello", resp.Revisions[0].Body)
+	assert.Equal(t, "user_1", resp.Revisions[0].EditorId)
+	assert.NotNil(t, resp.Revisions[0].CreatedAt)
+
+	client, ctx = serveMessages(t, &messagesStub{err: errors.Wrap(messages.ErrNotMember, "op")})
+	_, err = client.ListRevisions(ctx, &chatpb.ListRevisionsRequest{ChatId: "chat_1", MessageId: "msg_1"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestErrors(t *testing.T) {
+
+	cases := []struct {
+		name string
+		err  error
+		call func(context.Context, chatpb.ChatsClient) error
+		code codes.Code
+	}{
+		{"not found", errors.Wrap(chats.ErrNotFound, "op"), func(ctx context.Context, c chatpb.ChatsClient) error {
+			_, err := c.GetChat(ctx, &chatpb.GetChatRequest{ChatId: "chat_1"})
+			return err
+		}, codes.NotFound},
+		{"max members", errors.Wrap(chats.ErrMaxMembersNumExceeded, "op"), func(ctx context.Context, c chatpb.ChatsClient) error {
+			_, err := c.SetMember(ctx, &chatpb.SetMemberRequest{ChatId: "chat_1", UserId: "user_2", Role: "member"})
+			return err
+		}, codes.ResourceExhausted},
+		{"empty role", nil, func(ctx context.Context, c chatpb.ChatsClient) error {
+			_, err := c.SetMember(ctx, &chatpb.SetMemberRequest{ChatId: "chat_1", UserId: "user_2"})
+			return err
+		}, codes.InvalidArgument},
+		{"forbidden", errors.Wrap(chats.ErrForbidden, "op"), func(ctx context.Context, c chatpb.ChatsClient) error {
+			_, err := c.FindChatMembers(ctx, &chatpb.FindChatMembersRequest{ChatId: "chat_1"})
+			return err
+		}, codes.PermissionDenied},
+		{"internal", errors.New("connection refused"), func(ctx context.Context, c chatpb.ChatsClient) error {
+			_, err := c.GetChat(ctx, &chatpb.GetChatRequest{ChatId: "chat_1"})
+			return err
+		}, codes.Internal},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client, ctx := serve(t, &chatsStub{err: c.err}, hub.New())
+			err := c.call(ctx, client)
+			assert.Equal(t, c.code, status.Code(err))
+			if c.code == codes.Internal {
+				assert.Equal(t, "internal error", status.Convert(err).Message(), "internal errors must not be described")
+			}
+		})
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+
+	client, ctx := serve(t, &chatsStub{err: errors.Wrap(errs.Invalid("name", "cannot be blank"), "op")}, hub.New())
+
+	_, err := client.CreateChat(ctx, &chatpb.CreateChatRequest{Type: "group"})
+	st := status.Convert(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	details, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, details.FieldViolations, 1)
+	assert.Equal(t, "name", details.FieldViolations[0].Field)
+}
+
+func TestStreamEvents(t *testing.T) {
+
+	h := hub.New()
+	client, ctx := serve(t, &chatsStub{}, h)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	stream, err := client.StreamEvents(ctx, &chatpb.StreamEventsRequest{})
+	require.NoError(t, err)
+	_, err = stream.Header()
+	require.NoError(t, err)
+
+	now := time.Now()
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_2"})
+	h.Publish(ctx, &entities.Event{
+		Type:      entities.EventMessageCreated,
+		ChatID:    "chat_1",
+		Message:   &entities.Message{ID: "msg_1", UserID: "user_2", Body: "hello", CreatedAt: now},
+		CreatedAt: now,
+	})
+
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "chat_1", event.ChatId, "events of other chats must not be streamed")
+	assert.Equal(t, string(entities.EventMessageCreated), event.Type)
+	assert.Equal(t, "hello", event.Message.GetBody())
+	assert.True(t, now.Equal(event.CreatedAt.AsTime()))
+	assert.Nil(t, event.Message.EditedAt)
+
+	anonymous, err := client.StreamEvents(context.Background(), &chatpb.StreamEventsRequest{})
+	require.NoError(t, err)
+	_, err = anonymous.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
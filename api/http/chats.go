@@ -0,0 +1,262 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/util"
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+type chatResponse struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	NumMembers  int    `json:"num_members"`
+	Description string `json:"description,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+func newChatResponse(chat *entities.Chat) *chatResponse {
+	return &chatResponse{
+		ID:          chat.ID,
+		Type:        string(chat.Type),
+		Name:        chat.Name,
+		NumMembers:  chat.NumMembers,
+		Description: chat.Description,
+		AvatarURL:   chat.AvatarURL,
+	}
+}
+
+type createChatRequest struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	AvatarURL   string `json:"avatar_url"`
+}
+
+// Validate checks the request by the chat rules, hosts of avatars are checked by the service.
+func (r *createChatRequest) Validate() error {
+	return new(chats.ChatRules).Validate(r.chat())
+}
+
+func (r *createChatRequest) chat() *entities.Chat {
+	return &entities.Chat{
+		Type:        entities.ChatType(r.Type),
+		Name:        r.Name,
+		Description: r.Description,
+		AvatarURL:   r.AvatarURL,
+	}
+}
+
+// updateChatRequest changes the fields present only, chats are validated by the service.
+type updateChatRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+type setMemberRequest struct {
+	Role string `json:"role"`
+}
+
+func (r *setMemberRequest) Validate() error {
+	return validation.ValidateStruct(r,
+		validation.Field(&r.Role, validation.Required, validation.Length(1, 32)),
+	)
+}
+
+type pageResponse struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+func newPageResponse(page *util.Page) pageResponse {
+	if page == nil {
+		return pageResponse{}
+	}
+	return pageResponse{NextCursor: page.NextCursor, PrevCursor: page.PrevCursor}
+}
+
+type findChatsResponse struct {
+	Chats []*chatResponse `json:"chats"`
+	Total int             `json:"total"`
+	pageResponse
+}
+
+func (h *Handler) findChats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter := &chats.FindChatsFilter{
+		Name:           q.Get("name"),
+		IncludeDeleted: q.Get("include_deleted") == "true",
+	}
+	for _, typ := range q["type"] {
+		filter.Types = append(filter.Types, entities.ChatType(typ))
+	}
+
+	options, err := paginationOptions(q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	sort, err := chats.ParseSort(q.Get("sort"))
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	res, page, err := h.chats.FindChats(r.Context(), filter, options, sort)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	resp := &findChatsResponse{Chats: make([]*chatResponse, len(res)), pageResponse: newPageResponse(page)}
+	if page != nil {
+		resp.Total = page.Total
+	}
+	for i, chat := range res {
+		resp.Chats[i] = newChatResponse(chat)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) createChat(w http.ResponseWriter, r *http.Request) {
+	req := new(createChatRequest)
+	if err := decode(r, req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	chat, err := h.chats.CreateChat(r.Context(), req.chat())
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newChatResponse(chat))
+}
+
+func (h *Handler) getChat(w http.ResponseWriter, r *http.Request, chatID string) {
+	chat, err := h.chats.GetChat(r.Context(), chatID)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newChatResponse(chat))
+}
+
+func (h *Handler) updateChat(w http.ResponseWriter, r *http.Request, chatID string) {
+	req := new(updateChatRequest)
+	if err := decode(r, req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	chat, err := h.chats.UpdateChat(r.Context(), chatID, &chats.ChatUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		AvatarURL:   req.AvatarURL,
+	})
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newChatResponse(chat))
+}
+
+func (h *Handler) deleteChat(w http.ResponseWriter, r *http.Request, chatID string) {
+	if err := h.chats.DeleteChat(r.Context(), chatID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) restoreChat(w http.ResponseWriter, r *http.Request, chatID string) {
+	if err := h.chats.RestoreChat(r.Context(), chatID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) setMember(w http.ResponseWriter, r *http.Request, chatID, userID string) {
+	req := new(setMemberRequest)
+	if err := decode(r, req); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	if err := h.chats.SetMember(r.Context(), chatID, userID, entities.Role(req.Role)); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type userResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"full_name,omitempty"`
+	Status   string `json:"status,omitempty"`
+}
+
+type memberResponse struct {
+	UserID string        `json:"user_id"`
+	Role   string        `json:"role"`
+	User   *userResponse `json:"user,omitempty"`
+}
+
+type findChatMembersResponse struct {
+	Members []*memberResponse `json:"members"`
+	pageResponse
+}
+
+func (h *Handler) findChatMembers(w http.ResponseWriter, r *http.Request, chatID string) {
+	q := r.URL.Query()
+
+	filter := &chats.FindChatMembersFilter{}
+	for _, role := range q["role"] {
+		filter.Roles = append(filter.Roles, entities.Role(role))
+	}
+
+	options, err := paginationOptions(q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	members, page, err := h.chats.FindChatMembers(r.Context(), chatID, filter, options)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	resp := &findChatMembersResponse{Members: make([]*memberResponse, len(members)), pageResponse: newPageResponse(page)}
+	for i, m := range members {
+		resp.Members[i] = &memberResponse{UserID: m.UserID, Role: string(m.Role)}
+		if m.User != nil {
+			resp.Members[i].User = &userResponse{
+				ID:       m.User.ID,
+				Username: m.User.Username,
+				FullName: m.User.FullName,
+				Status:   m.User.Status,
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) deleteMember(w http.ResponseWriter, r *http.Request, chatID, userID string) {
+	if err := h.chats.DeleteMember(r.Context(), chatID, userID); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
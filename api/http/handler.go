@@ -0,0 +1,118 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/errs"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/pkg/errors"
+)
+
+type Handler struct {
+	chats chats.Chats
+}
+
+func NewHandler(chats chats.Chats) *Handler {
+	return &Handler{chats: chats}
+}
+
+// ServeHTTP routes requests. The handler expects the caller to be authenticated
+// by auth.HTTPMiddleware.
+//
+//	GET    /chats?type=&name=&include_deleted=&sort=&cursor=&limit=&offset=
+//	POST   /chats
+//	GET    /chats/{id}
+//	PATCH  /chats/{id}
+//	DELETE /chats/{id}
+//	POST   /chats/{id}/restore
+//	GET    /chats/{id}/members?role=&cursor=&limit=&offset=
+//	PUT    /chats/{id}/members/{userID}
+//	DELETE /chats/{id}/members/{userID}
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "chats" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		h.findChats(w, r)
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		h.createChat(w, r)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		h.getChat(w, r, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodPatch:
+		h.updateChat(w, r, parts[1])
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		h.deleteChat(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "restore" && r.Method == http.MethodPost:
+		h.restoreChat(w, r, parts[1])
+	case len(parts) == 3 && parts[2] == "members" && r.Method == http.MethodGet:
+		h.findChatMembers(w, r, parts[1])
+	case len(parts) == 4 && parts[2] == "members" && r.Method == http.MethodPut:
+		h.setMember(w, r, parts[1], parts[3])
+	case len(parts) == 4 && parts[2] == "members" && r.Method == http.MethodDelete:
+		h.deleteMember(w, r, parts[1], parts[3])
+	case len(parts) <= 2 || len(parts) == 3 && parts[2] == "restore" || len(parts) <= 4 && parts[2] == "members":
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func paginationOptions(q url.Values) (*util.PaginationOptions, error) {
+	options := new(util.PaginationOptions)
+	for name, v := range map[string]*uint{"limit": &options.Limit, "offset": &options.Offset} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return nil, errs.Invalid(name, "must be a non-negative integer")
+			}
+			*v = uint(n)
+		}
+	}
+	options.Cursor = q.Get("cursor")
+	return options, nil
+}
+
+// decode reads the request body, requests implementing validation.Validatable are validated.
+func decode(r *http.Request, req interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return errs.Wrap(err, errs.InvalidArgument, "invalid request body")
+	}
+	if v, ok := req.(validation.Validatable); ok {
+		return errs.Validation(v.Validate())
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type errorResponse struct {
+	Error  string            `json:"error"`
+	Code   errs.Code         `json:"code,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// writeServiceError writes the typed error of the chain, see errs.As. Errors without
+// a type are internal and not described.
+func writeServiceError(w http.ResponseWriter, err error) {
+	e := errs.As(err)
+	writeJSON(w, e.Code.HTTPStatus(), errorResponse{Error: e.Error(), Code: e.Code, Fields: e.Fields})
+}
@@ -0,0 +1,223 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chatsStub struct {
+	chats.Chats
+	chat *entities.Chat
+	err  error
+
+	filter  *chats.FindChatsFilter
+	options *util.PaginationOptions
+	sort    *util.SortOptions
+}
+
+func (s *chatsStub) CreateChat(ctx context.Context, chat *entities.Chat) (*entities.Chat, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	chat.ID = "chat_1"
+	chat.NumMembers = 1
+	s.chat = chat
+	return chat, nil
+}
+
+func (s *chatsStub) GetChat(_ context.Context, _ string) (*entities.Chat, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.chat, nil
+}
+
+func (s *chatsStub) FindChats(_ context.Context, filter *chats.FindChatsFilter, options *util.PaginationOptions, sort *util.SortOptions) ([]*entities.Chat, *util.Page, error) {
+	s.filter, s.options, s.sort = filter, options, sort
+	return []*entities.Chat{s.chat}, &util.Page{NextCursor: "next", Total: 10}, s.err
+}
+
+func (s *chatsStub) FindChatMembers(_ context.Context, _ string, _ *chats.FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error) {
+	s.options = options
+	return nil, nil, s.err
+}
+
+func (s *chatsStub) UpdateChat(_ context.Context, _ string, update *chats.ChatUpdate) (*entities.Chat, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	update.Apply(s.chat)
+	return s.chat, nil
+}
+
+func (s *chatsStub) SetMember(ctx context.Context, _, _ string, _ entities.Role) error {
+	if auth.GetUserID(ctx) == "" {
+		return errors.New("no user")
+	}
+	return s.err
+}
+
+func (s *chatsStub) RestoreChat(_ context.Context, _ string) error {
+	return s.err
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r = r.WithContext(auth.WithUser(r.Context(), "user_1"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCreateChat(t *testing.T) {
+
+	stub := &chatsStub{}
+	h := NewHandler(stub)
+
+	w := serve(h, http.MethodPost, "/chats", `{"type":"group","name":"group one","avatar_url":"https://test.some"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var resp chatResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "chat_1", resp.ID)
+	assert.Equal(t, "group one", resp.Name)
+
+	w = serve(h, http.MethodPost, "/chats", `{"type":"group"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "name is required for groups")
+
+	w = serve(h, http.MethodPost, "/chats", `{"type":"unknown","name":"foo"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestFindChats(t *testing.T) {
+
+	stub := &chatsStub{chat: &entities.Chat{ID: "chat_1", Type: entities.GroupType, Name: "group"}}
+	h := NewHandler(stub)
+
+	w := serve(h, http.MethodGet, "/chats?type=group&type=channel&name=gr&sort=-type,name&limit=5&offset=10", "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp findChatsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, 10, resp.Total)
+	assert.Equal(t, "next", resp.NextCursor)
+	require.Len(t, resp.Chats, 1)
+	assert.Equal(t, "chat_1", resp.Chats[0].ID)
+
+	assert.Equal(t, &chats.FindChatsFilter{Types: []entities.ChatType{entities.GroupType, entities.ChannelType}, Name: "gr"}, stub.filter)
+	assert.Equal(t, &util.PaginationOptions{Limit: 5, Offset: 10}, stub.options)
+	assert.Equal(t, &util.SortOptions{Sort: []util.SortField{{Name: "type", Descending: true}, {Name: "name"}}}, stub.sort)
+
+	w = serve(h, http.MethodGet, "/chats?sort=password", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(h, http.MethodGet, "/chats?limit=-1", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(h, http.MethodGet, "/chats/chat_1/members?limit=5&cursor=abc", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, &util.PaginationOptions{Limit: 5, Cursor: "abc"}, stub.options)
+
+	stub.err = errors.Wrap(util.ErrInvalidCursor, "Storage.FindChatMembers")
+	w = serve(h, http.MethodGet, "/chats/chat_1/members?cursor=abc", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUpdateChat(t *testing.T) {
+
+	stub := &chatsStub{chat: &entities.Chat{ID: "chat_1", Type: entities.GroupType, Name: "group", Description: "descr"}}
+	h := NewHandler(stub)
+
+	w := serve(h, http.MethodPatch, "/chats/chat_1", `{"name":"new name"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "new name", stub.chat.Name)
+	assert.Equal(t, "descr", stub.chat.Description, "omitted fields must stay unchanged")
+}
+
+func TestErrors(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		err    error
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"not found", errors.Wrap(chats.ErrNotFound, "op"), http.MethodGet, "/chats/chat_1", "", http.StatusNotFound},
+		{"max members", errors.Wrap(chats.ErrMaxMembersNumExceeded, "op"), http.MethodPut, "/chats/chat_1/members/user_2", `{"role":"member"}`, http.StatusConflict},
+		{"empty role", nil, http.MethodPut, "/chats/chat_1/members/user_2", `{"role":""}`, http.StatusBadRequest},
+		{"unknown role", errors.Wrap(chats.ErrUnknownRole, "op"), http.MethodPut, "/chats/chat_1/members/user_2", `{"role":"king"}`, http.StatusBadRequest},
+		{"forbidden", errors.Wrap(chats.ErrForbidden, "op"), http.MethodGet, "/chats/chat_1/members", "", http.StatusForbidden},
+		{"unknown route", nil, http.MethodGet, "/users", "", http.StatusNotFound},
+		{"wrong method", nil, http.MethodPost, "/chats/chat_1", "", http.StatusMethodNotAllowed},
+		{"restore", nil, http.MethodPost, "/chats/chat_1/restore", "", http.StatusNoContent},
+		{"restore dialog", errors.Wrap(chats.ErrDialogExists, "op"), http.MethodPost, "/chats/chat_1/restore", "", http.StatusConflict},
+		{"restore method", nil, http.MethodGet, "/chats/chat_1/restore", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := NewHandler(&chatsStub{err: c.err})
+			w := serve(h, c.method, c.path, c.body)
+			assert.Equal(t, c.status, w.Code)
+		})
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+
+	h := NewHandler(&chatsStub{err: errors.Wrap(errs.Invalid("name", "cannot be blank"), "op")})
+
+	w := serve(h, http.MethodPost, "/chats", `{"type":"group"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp errorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, errs.InvalidArgument, resp.Code)
+	assert.Equal(t, map[string]string{"name": "cannot be blank"}, resp.Fields)
+
+	w = serve(h, http.MethodPost, "/chats", `{"type":`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	h = NewHandler(&chatsStub{err: errors.Wrap(errors.New("connection refused"), "op")})
+	w = serve(h, http.MethodGet, "/chats/chat_1", "")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	resp = errorResponse{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "internal error", resp.Error, "internal errors are not described")
+}
+
+func TestUnauthorized(t *testing.T) {
+
+	tokens, err := auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	require.NoError(t, err)
+	h := auth.HTTPMiddleware(tokens, NewHandler(&chatsStub{err: errors.Wrap(auth.ErrUnauthenticated, "op")}))
+
+	{
+		r := httptest.NewRequest(http.MethodGet, "/chats/chat_1", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	{
+		r := httptest.NewRequest(http.MethodGet, "/chats/chat_1", nil)
+		r.Header.Set("Authorization", "Bearer foo")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+}
@@ -0,0 +1,188 @@
+package ws
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/services/events/hub"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write an event to the peer.
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+	// Send pings to peer with this period. Must be less than pongWait.
+	pingPeriod = pongWait * 9 / 10
+	// Clients are not expected to send anything except control frames.
+	maxMessageSize = 512
+	// Number of events buffered per connection before it is considered slow and dropped.
+	sendBufferSize = 256
+)
+
+// Gateway streams events of the user's chats over WebSocket. The caller is expected
+// to be authenticated by auth.WebSocketMiddleware.
+type Gateway struct {
+	hub         *hub.Hub
+	memberships chats.Memberships
+	upgrader    websocket.Upgrader
+
+	pongWait   time.Duration
+	pingPeriod time.Duration
+	bufferSize int
+}
+
+func NewGateway(hub *hub.Hub, memberships chats.Memberships) *Gateway {
+	return &Gateway{
+		hub:         hub,
+		memberships: memberships,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+		pongWait:   pongWait,
+		pingPeriod: pingPeriod,
+		bufferSize: sendBufferSize,
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	p, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, auth.ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+	userID := p.UserID
+
+	chatIDs, err := g.memberships.FindMemberChatIDs(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// subscribe before the handshake completes, so that the client gets
+	// all events published after it has connected
+	sub := g.hub.Subscribe(userID, chatIDs, g.bufferSize)
+
+	conn, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has already replied with an error
+		sub.Close()
+		return
+	}
+
+	go g.writePump(conn, sub)
+	go g.readPump(conn, sub)
+}
+
+// readPump discards incoming messages and keeps the read deadline up to date
+// with pongs. The subscription is closed once the peer goes away.
+func (g *Gateway) readPump(conn *websocket.Conn, sub *hub.Subscription) {
+	defer sub.Close()
+
+	conn.SetReadLimit(maxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(g.pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(g.pongWait))
+	})
+
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// writePump delivers events and pings to the peer. It owns all writes to the connection.
+func (g *Gateway) writePump(conn *websocket.Conn, sub *hub.Subscription) {
+	ticker := time.NewTicker(g.pingPeriod)
+	defer func() {
+		ticker.Stop()
+		sub.Close()
+		_ = conn.Close()
+	}()
+
+	for {
+		select {
+		case event := <-sub.Events():
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(newEventMessage(event)); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-sub.Done():
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "subscription closed"),
+				time.Now().Add(writeWait),
+			)
+			return
+		}
+	}
+}
+
+type chatMessage struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	NumMembers  int    `json:"num_members"`
+	Description string `json:"description,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+type messageMessage struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Body      string     `json:"body,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+}
+
+type eventMessage struct {
+	Type      string          `json:"type"`
+	ChatID    string          `json:"chat_id"`
+	UserID    string          `json:"user_id,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Chat      *chatMessage    `json:"chat,omitempty"`
+	Message   *messageMessage `json:"message,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func newEventMessage(e *entities.Event) *eventMessage {
+	m := &eventMessage{
+		Type:      string(e.Type),
+		ChatID:    e.ChatID,
+		UserID:    e.UserID,
+		Role:      string(e.Role),
+		CreatedAt: e.CreatedAt,
+	}
+	if e.Chat != nil {
+		m.Chat = &chatMessage{
+			ID:          e.Chat.ID,
+			Type:        string(e.Chat.Type),
+			Name:        e.Chat.Name,
+			NumMembers:  e.Chat.NumMembers,
+			Description: e.Chat.Description,
+			AvatarURL:   e.Chat.AvatarURL,
+		}
+	}
+	if e.Message != nil {
+		m.Message = &messageMessage{
+			ID:        e.Message.ID,
+			UserID:    e.Message.UserID,
+			Body:      e.Message.Body,
+			CreatedAt: e.Message.CreatedAt,
+			EditedAt:  e.Message.EditedAt,
+		}
+	}
+	return m
+}
@@ -0,0 +1,170 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/events/hub"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type membershipsStub map[string][]string
+
+func (s membershipsStub) FindMemberChatIDs(_ context.Context, userID string) ([]string, error) {
+	return s[userID], nil
+}
+
+type testServer struct {
+	*httptest.Server
+	tokens *auth.Tokens
+}
+
+func newTestServer(t *testing.T, g *Gateway) *testServer {
+	tokens, err := auth.NewTokens([]byte("0123456789abcdef0123456789abcdef"), time.Hour)
+	require.NoError(t, err)
+	srv := httptest.NewServer(auth.WebSocketMiddleware(tokens, g))
+	t.Cleanup(srv.Close)
+	return &testServer{Server: srv, tokens: tokens}
+}
+
+func (s *testServer) dial(token string) (*websocket.Conn, *http.Response, error) {
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+	if token != "" {
+		url += "?access_token=" + token
+	}
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func (s *testServer) connect(t *testing.T, userID string) *websocket.Conn {
+	token, err := s.tokens.Issue(&entities.User{ID: userID})
+	require.NoError(t, err)
+
+	conn, _, err := s.dial(token)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) *eventMessage {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	var e eventMessage
+	require.NoError(t, conn.ReadJSON(&e))
+	return &e
+}
+
+func TestGateway_Unauthenticated(t *testing.T) {
+
+	srv := newTestServer(t, NewGateway(hub.New(), membershipsStub{}))
+
+	_, resp, err := srv.dial("")
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, resp, err = srv.dial("invalid")
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestGateway_Subscription(t *testing.T) {
+
+	ctx := context.Background()
+	h := hub.New()
+	srv := newTestServer(t, NewGateway(h, membershipsStub{"user_1": {"chat_1"}}))
+
+	conn := srv.connect(t, "user_1")
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_2"})
+	h.Publish(ctx, &entities.Event{
+		Type:    entities.EventMessageCreated,
+		ChatID:  "chat_1",
+		Message: &entities.Message{ID: "message_1", UserID: "user_2", Body: "hello"},
+	})
+
+	e := readEvent(t, conn)
+	assert.Equal(t, "chat_1", e.ChatID, "events of other chats are not delivered")
+	assert.Equal(t, string(entities.EventMessageCreated), e.Type)
+	require.NotNil(t, e.Message)
+	assert.Equal(t, "hello", e.Message.Body)
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMemberAdded, ChatID: "chat_2", UserID: "user_1"})
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_2"})
+
+	assert.Equal(t, string(entities.EventMemberAdded), readEvent(t, conn).Type)
+	assert.Equal(t, "chat_2", readEvent(t, conn).ChatID, "new chats are subscribed to")
+}
+
+func TestGateway_PingPong(t *testing.T) {
+
+	ctx := context.Background()
+	h := hub.New()
+	g := NewGateway(h, membershipsStub{"user_1": {"chat_1"}})
+	g.pingPeriod = 10 * time.Millisecond
+	g.pongWait = 50 * time.Millisecond
+	srv := newTestServer(t, g)
+
+	t.Run("alive", func(t *testing.T) {
+		conn := srv.connect(t, "user_1")
+
+		var pings int32
+		conn.SetPingHandler(func(data string) error {
+			atomic.AddInt32(&pings, 1)
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+
+		time.AfterFunc(200*time.Millisecond, func() {
+			h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_1"})
+		})
+
+		assert.Equal(t, "chat_1", readEvent(t, conn).ChatID, "the connection answering pings is kept")
+		assert.GreaterOrEqual(t, atomic.LoadInt32(&pings), int32(2))
+	})
+
+	t.Run("dead", func(t *testing.T) {
+		conn := srv.connect(t, "user_1")
+		conn.SetPingHandler(func(string) error { return nil })
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "the connection without pongs is closed: %v", err)
+	})
+}
+
+func TestGateway_SlowConsumer(t *testing.T) {
+
+	const events = 32
+
+	ctx := context.Background()
+	h := hub.New()
+	g := NewGateway(h, membershipsStub{"user_1": {"chat_1"}})
+	g.bufferSize = 1
+	srv := newTestServer(t, g)
+
+	conn := srv.connect(t, "user_1")
+
+	body := strings.Repeat("a", 256*1024)
+	for i := 0; i < events; i++ {
+		h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_1", Message: &entities.Message{Body: body}})
+	}
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	received := 0
+	for {
+		_, _, err := conn.ReadMessage()
+		if err != nil {
+			assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "the slow connection is closed: %v", err)
+			break
+		}
+		received++
+	}
+	assert.Less(t, received, events)
+}
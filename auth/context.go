@@ -1,14 +1,48 @@
 package auth
 
-import "context"
+import (
+	"context"
 
-type userIDKey struct{}
+	"github.com/alenapetraki/chat/util/errs"
+)
+
+var ErrUnauthenticated = errs.New(errs.Unauthenticated, "unauthenticated")
+
+// Principal is an authenticated user on whose behalf the request is made.
+type Principal struct {
+	UserID   string
+	Username string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func UserFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	if !ok || p.UserID == "" {
+		return Principal{}, false
+	}
+	return p, true
+}
 
 func WithUser(ctx context.Context, userID string) context.Context {
-	return context.WithValue(ctx, userIDKey{}, userID)
+	return WithPrincipal(ctx, Principal{UserID: userID})
 }
 
+// GetUserID returns ID of the authenticated user or an empty string.
 func GetUserID(ctx context.Context) string {
-	userID := ctx.Value(userIDKey{}).(string)
-	return userID
+	p, _ := UserFromContext(ctx)
+	return p.UserID
+}
+
+// RequireUser returns ID of the authenticated user or ErrUnauthenticated.
+func RequireUser(ctx context.Context) (string, error) {
+	p, ok := UserFromContext(ctx)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return p.UserID, nil
 }
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alenapetraki/chat/util/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func UnaryServerInterceptor(verifier Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, verifier)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func StreamServerInterceptor(verifier Verifier) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), verifier)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate reads a bearer token from the "authorization" metadata key.
+// Calls without a token are passed through anonymously.
+func authenticate(ctx context.Context, verifier Verifier) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ctx, nil
+	}
+
+	p, err := verifier.Verify(strings.TrimPrefix(values[0], "Bearer "))
+	if err != nil {
+		return nil, errs.GRPCStatus(ErrUnauthenticated).Err()
+	}
+	return WithPrincipal(ctx, p), nil
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
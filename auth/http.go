@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HTTPMiddleware authenticates requests carrying a bearer token in the Authorization header.
+// Requests without a token are passed through anonymously, requests with an invalid one are rejected.
+func HTTPMiddleware(verifier Verifier, next http.Handler) http.Handler {
+	return middleware(verifier, next, headerToken)
+}
+
+// WebSocketMiddleware is HTTPMiddleware for WebSocket upgrades, which also accepts the token
+// in the access_token query parameter, since browsers cannot set headers of WebSockets.
+// Query parameters end up in logs, so it must not be used for other routes.
+func WebSocketMiddleware(verifier Verifier, next http.Handler) http.Handler {
+	return middleware(verifier, next, func(r *http.Request) string {
+		if token := headerToken(r); token != "" {
+			return token
+		}
+		return r.URL.Query().Get("access_token")
+	})
+}
+
+func middleware(verifier Verifier, next http.Handler, tokenOf func(r *http.Request) string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		token := tokenOf(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := verifier.Verify(token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+func headerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
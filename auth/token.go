@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidToken = errs.New(errs.Unauthenticated, "invalid token")
+	ErrTokenExpired = errs.New(errs.Unauthenticated, "token expired")
+)
+
+type Verifier interface {
+	Verify(token string) (Principal, error)
+}
+
+// MinSecretLength is the minimum length of the HS256 secret, as long as the hash.
+const MinSecretLength = 32
+
+// Tokens issues and verifies access tokens in JWT format signed with HS256.
+type Tokens struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokens fails if the secret is shorter than MinSecretLength.
+func NewTokens(secret []byte, ttl time.Duration) (*Tokens, error) {
+	const op = "NewTokens"
+
+	if len(secret) < MinSecretLength {
+		return nil, errors.Wrap(errors.Errorf("secret must be at least %d bytes", MinSecretLength), op)
+	}
+	return &Tokens{secret: secret, ttl: ttl, now: time.Now}, nil
+}
+
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type claims struct {
+	Subject   string `json:"sub"`
+	Username  string `json:"name,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (t *Tokens) Issue(user *entities.User) (string, error) {
+	const op = "Tokens.Issue"
+
+	if user.ID == "" {
+		return "", errors.Wrap(errors.New("user id required"), op)
+	}
+
+	now := t.now()
+	payload, err := json.Marshal(&claims{
+		Subject:   user.ID,
+		Username:  user.Username,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.ttl).Unix(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, op)
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + t.sign(unsigned), nil
+}
+
+func (t *Tokens) Verify(token string) (Principal, error) {
+	const op = "Tokens.Verify"
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return Principal{}, errors.Wrap(ErrInvalidToken, op)
+	}
+
+	unsigned := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(unsigned))) {
+		return Principal{}, errors.Wrap(ErrInvalidToken, op)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Principal{}, errors.Wrap(ErrInvalidToken, op)
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil || c.Subject == "" {
+		return Principal{}, errors.Wrap(ErrInvalidToken, op)
+	}
+	if t.now().Unix() >= c.ExpiresAt {
+		return Principal{}, errors.Wrap(ErrTokenExpired, op)
+	}
+
+	return Principal{UserID: c.Subject, Username: c.Username}, nil
+}
+
+func (t *Tokens) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+func newTokens(t *testing.T, secret string) *Tokens {
+	tokens, err := NewTokens([]byte(secret), time.Hour)
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestTokens(t *testing.T) {
+
+	tokens := newTokens(t, secret)
+
+	token, err := tokens.Issue(&entities.User{ID: "user_1", Username: "alice"})
+	require.NoError(t, err)
+
+	p, err := tokens.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, Principal{UserID: "user_1", Username: "alice"}, p)
+
+	_, err = newTokens(t, "fedcba9876543210fedcba9876543210").Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = tokens.Verify(token[:len(token)-2])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	tokens.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = tokens.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestNewTokens_ShortSecret(t *testing.T) {
+
+	_, err := NewTokens([]byte("secret"), time.Hour)
+	assert.Error(t, err)
+
+	_, err = NewTokens([]byte(secret[:MinSecretLength-1]), time.Hour)
+	assert.Error(t, err)
+}
+
+func TestUserFromContext(t *testing.T) {
+
+	_, ok := UserFromContext(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, "", GetUserID(context.Background()))
+
+	_, err := RequireUser(context.Background())
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	userID, err := RequireUser(WithUser(context.Background(), "user_1"))
+	require.NoError(t, err)
+	assert.Equal(t, "user_1", userID)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+
+	tokens := newTokens(t, secret)
+	token, err := tokens.Issue(&entities.User{ID: "user_1"})
+	require.NoError(t, err)
+
+	var userID string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = GetUserID(r.Context())
+	})
+
+	cases := []struct {
+		name   string
+		ws     bool
+		header string
+		query  string
+		status int
+		userID string
+	}{
+		{"anonymous", false, "", "", http.StatusOK, ""},
+		{"header", false, "Bearer " + token, "", http.StatusOK, "user_1"},
+		{"query", false, "", "?access_token=" + token, http.StatusOK, ""},
+		{"invalid", false, "Bearer foo", "", http.StatusUnauthorized, ""},
+		{"ws header", true, "Bearer " + token, "", http.StatusOK, "user_1"},
+		{"ws query", true, "", "?access_token=" + token, http.StatusOK, "user_1"},
+		{"ws invalid query", true, "", "?access_token=foo", http.StatusUnauthorized, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := HTTPMiddleware(tokens, next)
+			if c.ws {
+				h = WebSocketMiddleware(tokens, next)
+			}
+
+			userID = ""
+			r := httptest.NewRequest(http.MethodGet, "/"+c.query, nil)
+			if c.header != "" {
+				r.Header.Set("Authorization", c.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			assert.Equal(t, c.status, w.Code)
+			assert.Equal(t, c.userID, userID)
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package entities
 
+import "time"
+
 type Chat struct {
 	ID          string
 	Type        ChatType
@@ -7,6 +9,7 @@ type Chat struct {
 	NumMembers  int
 	Description string
 	AvatarURL   string
+	DeletedAt   *time.Time
 }
 
 type ChatType string
@@ -17,16 +20,31 @@ const (
 	ChannelType ChatType = "channel"
 )
 
-type Role string
+type ChatMember struct {
+	//Chat *Chat
+	UserID string
+	Role   Role
+	// User is a profile of the member, filled in when available.
+	User *User
+}
+
+type OwnershipReason string
 
 const (
-	RoleMember Role = "member"
-	RoleOwner  Role = "owner"
+	OwnershipTransferred OwnershipReason = "transferred"
+	OwnershipLeft        OwnershipReason = "left"
+	// OwnershipGranted is a co-owner made by an owner.
+	OwnershipGranted OwnershipReason = "granted"
+	// OwnershipInherited is a promotion of an admin when the last owner's account is deleted.
+	OwnershipInherited OwnershipReason = "inherited"
 )
 
-type ChatMember struct {
-	//Chat *Chat
-	//User *account.User
-	UserID string
-	Role   string
+// OwnershipChange is a record of the chat ownership history. FromUserID is the owner
+// who lost ownership, ToUserID is the one who got it, either may be empty.
+type OwnershipChange struct {
+	ChatID     string
+	FromUserID string
+	ToUserID   string
+	Reason     OwnershipReason
+	CreatedAt  time.Time
 }
@@ -0,0 +1,31 @@
+package entities
+
+import "time"
+
+type EventType string
+
+const (
+	EventChatUpdated       EventType = "chat_updated"
+	EventChatDeleted       EventType = "chat_deleted"
+	EventChatRestored      EventType = "chat_restored"
+	EventMemberAdded       EventType = "member_added"
+	EventMemberRemoved     EventType = "member_removed"
+	EventMemberRoleChanged EventType = "member_role_changed"
+	EventMessageCreated    EventType = "message_created"
+	EventMessageEdited     EventType = "message_edited"
+	EventMessageDeleted    EventType = "message_deleted"
+)
+
+type Event struct {
+	Type   EventType
+	ChatID string
+	// UserID is the member the event is about, set for member events.
+	UserID string
+	Role   Role
+	// Private events are delivered to the member they are about only,
+	// so that joins of channel subscribers are not sent to all of them.
+	Private   bool
+	Chat      *Chat
+	Message   *Message
+	CreatedAt time.Time
+}
@@ -0,0 +1,20 @@
+package entities
+
+import "time"
+
+type Message struct {
+	ID        string
+	ChatID    string
+	UserID    string
+	Body      string
+	CreatedAt time.Time
+	EditedAt  *time.Time
+}
+
+// MessageRevision keeps a previous body of an edited message.
+type MessageRevision struct {
+	MessageID string
+	EditorID  string
+	Body      string
+	CreatedAt time.Time
+}
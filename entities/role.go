@@ -0,0 +1,56 @@
+package entities
+
+type Role string
+
+// Built-in roles from the highest rank to the lowest one.
+const (
+	RoleOwner      Role = "owner"
+	RoleAdmin      Role = "admin"
+	RoleModerator  Role = "moderator"
+	RoleMember     Role = "member"
+	RoleSubscriber Role = "subscriber"
+)
+
+// Permission is a set of actions a role allows.
+type Permission uint32
+
+const (
+	PermPost Permission = 1 << iota
+	PermInvite
+	PermKick
+	PermEditChat
+	PermPin
+	// PermDeleteMessages allows to delete messages of other members.
+	PermDeleteMessages
+
+	PermAll = PermPost | PermInvite | PermKick | PermEditChat | PermPin | PermDeleteMessages
+)
+
+// Has reports whether all of the permissions p are in the set.
+func (perm Permission) Has(p Permission) bool {
+	return perm&p == p
+}
+
+// ChatRole describes a role: what members with it can do and whom they manage.
+// Members manage members of lower ranks only.
+type ChatRole struct {
+	Name        Role
+	Rank        int
+	Permissions Permission
+}
+
+// MaxCustomRoleRank is the maximum rank of a custom role, custom roles are below admins.
+const MaxCustomRoleRank = 79
+
+var BuiltinRoles = map[Role]*ChatRole{
+	RoleOwner:      {Name: RoleOwner, Rank: 100, Permissions: PermAll},
+	RoleAdmin:      {Name: RoleAdmin, Rank: 80, Permissions: PermAll},
+	RoleModerator:  {Name: RoleModerator, Rank: 60, Permissions: PermPost | PermInvite | PermKick | PermPin | PermDeleteMessages},
+	RoleMember:     {Name: RoleMember, Rank: 40, Permissions: PermPost | PermInvite},
+	RoleSubscriber: {Name: RoleSubscriber, Rank: 20},
+}
+
+func IsBuiltinRole(role Role) bool {
+	_, ok := BuiltinRoles[role]
+	return ok
+}
@@ -1,8 +1,13 @@
 package chats
 
-import "github.com/pkg/errors"
+import "github.com/alenapetraki/chat/util/errs"
 
 var (
-	ErrNotFound              = errors.New("not found")
-	ErrMaxMembersNumExceeded = errors.New("max number of members is exceeded")
+	ErrNotFound              = errs.New(errs.NotFound, "not found")
+	ErrMaxMembersNumExceeded = errs.New(errs.LimitExceeded, "max number of members is exceeded")
+	ErrForbidden             = errs.New(errs.Forbidden, "operation is not permitted")
+	ErrUnknownRole           = errs.New(errs.InvalidArgument, "unknown role")
+	ErrRoleInUse             = errs.New(errs.Conflict, "role is assigned to members")
+	ErrDialogExists          = errs.New(errs.Conflict, "users already have a dialog")
+	ErrCursorWithSort        = errs.New(errs.InvalidArgument, "cursor cannot be used with custom sort")
 )
@@ -2,6 +2,7 @@ package chats
 
 import (
 	"context"
+	"time"
 
 	"github.com/alenapetraki/chat/entities"
 	"github.com/alenapetraki/chat/storage"
@@ -9,19 +10,100 @@ import (
 )
 
 const (
+	// MaxGroupMembersAllowed is the default limit of group members, see ChatPolicy.
 	MaxGroupMembersAllowed = 1000
+	// DefaultGracePeriod is how long deleted chats can be restored before they are purged.
+	DefaultGracePeriod = 30 * 24 * time.Hour
 )
 
+// SortFields are fields chats can be sorted by. Chats are sorted by id by default,
+// which is the order they were created in, so created_at sorts by id too.
+var SortFields = util.SortFields{
+	"id":          "id",
+	"created_at":  "id",
+	"name":        "name",
+	"type":        "type",
+	"num_members": "num_members",
+}
+
+// ParseSort parses a sort spec like "-num_members,name", see util.SortFields.Parse.
+func ParseSort(spec string) (*util.SortOptions, error) {
+	return SortFields.Parse(spec)
+}
+
+func ValidateSort(sort *util.SortOptions) error {
+	return SortFields.Validate(sort)
+}
+
+type FindChatsFilter struct {
+	// MemberID limits chats to those the user is a member of.
+	MemberID string
+	Types    []entities.ChatType
+	// Name is a case-insensitive substring of the chat name.
+	Name           string
+	IncludeDeleted bool
+}
+
 type Chats interface {
 	CreateChat(ctx context.Context, chat *entities.Chat) (*entities.Chat, error)
-	UpdateChat(ctx context.Context, chat *entities.Chat) error
+	// UpdateChat changes attributes of the chat set in the update and returns the updated chat.
+	UpdateChat(ctx context.Context, chatID string, update *ChatUpdate) (*entities.Chat, error)
 	GetChat(ctx context.Context, chatID string) (*entities.Chat, error)
+	// DeleteChat marks the chat deleted, owners may restore it within the grace period.
 	DeleteChat(ctx context.Context, chatID string) error
+	// RestoreChat restores the chat deleted within the grace period with its members.
+	RestoreChat(ctx context.Context, chatID string) error
+	// GetOrCreateDialog returns the dialog of the current user with the other one,
+	// creating it if they have none. Users have one dialog at most.
+	GetOrCreateDialog(ctx context.Context, otherUserID string) (*entities.Chat, error)
 
+	// SetMember adds the user to the chat or changes their role. Owners may make co-owners,
+	// who can only leave the chat themselves.
 	SetMember(ctx context.Context, chatID, userID string, role entities.Role) error
 	DeleteMember(ctx context.Context, chatID, userID string) error
+	// Subscribe joins an open chat by the current user with the default role of the chat.
+	// Chats without a member limit, like channels, are not locked to join them.
+	Subscribe(ctx context.Context, chatID string) error
 	GetRole(ctx context.Context, chatID, userID string) (entities.Role, error)
-	//FindChatMembers(ctx context.Context, chatID string, options *commons.PaginationOptions) ([]*ChatMember, error)
+	// Permissions returns permissions of the current user in the chat, ErrNotFound if the user is not a member.
+	Permissions(ctx context.Context, chatID string) (entities.Permission, error)
+	// SetChatRole creates or updates a custom role of the chat, only owners define roles.
+	SetChatRole(ctx context.Context, chatID string, role *entities.ChatRole) error
+	// DeleteChatRole deletes a custom role which is not assigned to anyone.
+	DeleteChatRole(ctx context.Context, chatID string, name entities.Role) error
+	FindChatRoles(ctx context.Context, chatID string) ([]*entities.ChatRole, error)
+
+	// TransferOwnership makes the member an owner instead of the current user, who becomes an admin.
+	TransferOwnership(ctx context.Context, chatID, newOwnerID string) error
+	// FindOwnershipChanges returns the ownership history of the chat from the oldest change.
+	FindOwnershipChanges(ctx context.Context, chatID string) ([]*entities.OwnershipChange, error)
+	// RemoveUser removes the current user from all chats when the account is deleted. Chats the user
+	// was the last owner of pass to their longest-standing admin.
+	RemoveUser(ctx context.Context, userID string) error
+
+	// FindChatMembers returns members of a chat the current user is a member of, ordered by user id.
+	FindChatMembers(ctx context.Context, chatID string, filter *FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error)
+
+	// FindChats returns chats of the current user matching the filter. The page has the total
+	// number of them. Cursors are only supported with the default sort.
+	FindChats(ctx context.Context, filter *FindChatsFilter, options *util.PaginationOptions, sort *util.SortOptions) ([]*entities.Chat, *util.Page, error)
+}
+
+// Jobs are maintenance tasks run periodically or by administrators, not on behalf of users.
+type Jobs interface {
+	// ReconcileMemberCounts recomputes numbers of members of chats from their members,
+	// it returns the number of chats which had a wrong number.
+	ReconcileMemberCounts(ctx context.Context) (int, error)
+	// PurgeDeletedChats deletes chats whose grace period has expired with their members
+	// and messages, it returns the number of chats deleted.
+	PurgeDeletedChats(ctx context.Context) (int, error)
+	// SetChatPolicy overrides the policy of the chat type for the chat, e.g. for premium
+	// or large groups. Nil policy removes the override. Dialogs keep the policy of their type.
+	SetChatPolicy(ctx context.Context, chatID string, policy *ChatPolicy) error
+}
+
+type FindChatMembersFilter struct {
+	Roles []entities.Role
 }
 
 type Storage interface {
@@ -30,15 +112,79 @@ type Storage interface {
 	CreateChat(ctx context.Context, chat *entities.Chat) error
 	UpdateChat(ctx context.Context, chat *entities.Chat) error
 	GetChat(ctx context.Context, chatID string) (*entities.Chat, error)
+	// GetChatForUpdate gets a chat locking it until the end of the transaction,
+	// so that changes of its members are serialized.
+	GetChatForUpdate(ctx context.Context, chatID string) (*entities.Chat, error)
+	// DeleteChat marks the chat deleted keeping its members, forced deletion removes
+	// the chat marked deleted with its members.
 	DeleteChat(ctx context.Context, chatID string, force ...bool) error
-	//FindChats(ctx context.Context, filter *FindChatsFilter, option *chats.Chat.PaginationOptions) ([]*chats.Chat.Chat, int, error)
+	// GetDeletedChat returns the chat marked deleted with the time it was deleted at.
+	GetDeletedChat(ctx context.Context, chatID string) (*entities.Chat, error)
+	// RestoreChat unmarks the deleted chat, it fails with ErrDialogExists
+	// if users of the dialog have another one.
+	RestoreChat(ctx context.Context, chatID string) error
+	// FindDeletedChatIDs returns up to limit chats deleted before the time, the earliest deleted first.
+	FindDeletedChatIDs(ctx context.Context, before time.Time, limit uint) ([]string, error)
+	// GetChatPolicy returns the policy of the chat or nil if it has the policy of its type.
+	GetChatPolicy(ctx context.Context, chatID string) (*ChatPolicy, error)
+	// SetChatPolicy overrides the policy of the chat type, nil policy removes the override.
+	SetChatPolicy(ctx context.Context, chatID string, policy *ChatPolicy) error
+	FindChats(ctx context.Context, filter *FindChatsFilter, options *util.PaginationOptions, sort *util.SortOptions) ([]*entities.Chat, *util.Page, error)
 
-	SetMember(ctx context.Context, chatID, userID string, role entities.Role) error
+	// SetMember adds the member or changes the role of an existing one, it reports whether the member is added.
+	SetMember(ctx context.Context, chatID, userID string, role entities.Role) (bool, error)
+	// AddSubscriber adds the member unless the user is a member already, it reports whether
+	// the member is added. It does not lock the chat, so many users may join at once.
+	AddSubscriber(ctx context.Context, chatID, userID string, role entities.Role) (bool, error)
 	DeleteMembers(ctx context.Context, chatID string, userID ...string) (int, error)
 	GetRole(ctx context.Context, chatID, userID string) (entities.Role, error)
-	FindChatMembers(ctx context.Context, chatID string, options *util.PaginationOptions) ([]*entities.ChatMember, error)
+	FindChatMembers(ctx context.Context, chatID string, filter *FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error)
+	// FindMemberChatIDs returns chats the user is a member of, chats marked deleted are not returned.
+	FindMemberChatIDs(ctx context.Context, userID string) ([]string, error)
+	// DeleteMemberOfDeletedChats removes the user from chats marked deleted, so that restoring
+	// them does not bring the user back. It returns the number of chats the user is removed from.
+	DeleteMemberOfDeletedChats(ctx context.Context, userID string) (int, error)
+	// ReconcileMemberCounts sets numbers of members of chats to their actual numbers,
+	// it returns the number of chats updated.
+	ReconcileMemberCounts(ctx context.Context) (int, error)
+
+	// GetDialog returns the dialog of two users in any order.
+	GetDialog(ctx context.Context, userID1, userID2 string) (*entities.Chat, error)
+	// SetDialogUsers binds the dialog to its users, it fails with ErrDialogExists
+	// if they have another dialog.
+	SetDialogUsers(ctx context.Context, chatID, userID1, userID2 string) error
+	// GetOldestMember returns the member with the role who joined the chat first.
+	GetOldestMember(ctx context.Context, chatID string, role entities.Role) (*entities.ChatMember, error)
+
+	AddOwnershipChange(ctx context.Context, change *entities.OwnershipChange) error
+	// FindOwnershipChanges returns the ownership history of the chat from the oldest change.
+	FindOwnershipChanges(ctx context.Context, chatID string) ([]*entities.OwnershipChange, error)
+
+	// SetChatRole creates or updates a custom role of the chat.
+	SetChatRole(ctx context.Context, chatID string, role *entities.ChatRole) error
+	GetChatRole(ctx context.Context, chatID string, name entities.Role) (*entities.ChatRole, error)
+	// FindChatRoles returns custom roles of the chat ordered by rank from the highest one.
+	FindChatRoles(ctx context.Context, chatID string) ([]*entities.ChatRole, error)
+	DeleteChatRole(ctx context.Context, chatID string, name entities.Role) error
 }
 
 type Tx interface {
-	RunTx(f func(tx *storage.Transaction) error) error
+	// RunTx runs f with a storage bound to a transaction. The transaction is rolled back
+	// if f returns an error or panics. Calls on the bound storage start nested transactions.
+	RunTx(ctx context.Context, opts *storage.TxOptions, f func(st Storage) error) error
+}
+
+// Messages deletes messages of purged chats, normally implemented by messages.Storage.
+type Messages interface {
+	DeleteChatMessages(ctx context.Context, chatID string) (int, error)
+}
+
+// Memberships finds chats of a user for streaming their events, normally implemented by Storage.
+type Memberships interface {
+	FindMemberChatIDs(ctx context.Context, userID string) ([]string, error)
+}
+
+// Users provides profiles of chat members, normally implemented by users.Storage.
+type Users interface {
+	GetUsers(ctx context.Context, userIDs []string) ([]*entities.User, error)
 }
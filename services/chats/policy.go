@@ -0,0 +1,127 @@
+package chats
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/alenapetraki/chat/entities"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/pkg/errors"
+)
+
+// ChatPolicy restricts what members of a chat can do.
+type ChatPolicy struct {
+	// MaxMembers is the maximum number of members, 0 means no limit.
+	MaxMembers int `json:"max_members"`
+	// AddMembers are built-in roles which may add other members.
+	AddMembers []entities.Role `json:"add_members"`
+	// EditChat are built-in roles which may change the chat name, description and avatar.
+	EditChat []entities.Role `json:"edit_chat"`
+	// CanLeave allows members to leave the chat. Owners never leave.
+	CanLeave bool `json:"can_leave"`
+	// Open allows anyone to join the chat by themselves with DefaultRole.
+	Open        bool          `json:"open"`
+	DefaultRole entities.Role `json:"default_role"`
+	// Broadcast makes the chat one-to-many: only owners and admins post, and readers,
+	// members without permissions, neither see other members nor hear about them.
+	Broadcast bool `json:"broadcast"`
+}
+
+func (p *ChatPolicy) Validate() error {
+	return validation.ValidateStruct(p,
+		validation.Field(&p.MaxMembers, validation.Min(0)),
+		validation.Field(&p.AddMembers, validation.Each(isBuiltinRole)),
+		validation.Field(&p.EditChat, validation.Each(isBuiltinRole)),
+		validation.Field(&p.DefaultRole, validation.Required, isBuiltinRole, validation.NotIn(entities.RoleOwner)),
+	)
+}
+
+var isBuiltinRole = validation.By(func(v interface{}) error {
+	if role, _ := v.(entities.Role); !entities.IsBuiltinRole(role) {
+		return errors.New("must be a built-in role")
+	}
+	return nil
+})
+
+// Permissions returns permissions of the role in chats with the policy. Built-in roles may
+// invite members and edit the chat if the policy allows it, custom roles if they have permissions.
+func (p *ChatPolicy) Permissions(role *entities.ChatRole) entities.Permission {
+	if !entities.IsBuiltinRole(role.Name) {
+		return role.Permissions
+	}
+	perm := role.Permissions &^ (entities.PermInvite | entities.PermEditChat)
+	if containsRole(p.AddMembers, role.Name) {
+		perm |= entities.PermInvite
+	}
+	if containsRole(p.EditChat, role.Name) {
+		perm |= entities.PermEditChat
+	}
+	if p.Broadcast && role.Name != entities.RoleOwner && role.Name != entities.RoleAdmin {
+		perm &^= entities.PermPost
+	}
+	return perm
+}
+
+// Policies are policies of chats by their type. A chat can have its own policy
+// overriding the one of its type.
+type Policies map[entities.ChatType]*ChatPolicy
+
+func DefaultPolicies() Policies {
+	return Policies{
+		entities.DialogType: {
+			MaxMembers:  2,
+			AddMembers:  []entities.Role{entities.RoleOwner},
+			DefaultRole: entities.RoleMember,
+		},
+		entities.GroupType: {
+			MaxMembers:  MaxGroupMembersAllowed,
+			AddMembers:  []entities.Role{entities.RoleOwner, entities.RoleAdmin, entities.RoleModerator, entities.RoleMember},
+			EditChat:    []entities.Role{entities.RoleOwner, entities.RoleAdmin},
+			CanLeave:    true,
+			DefaultRole: entities.RoleMember,
+		},
+		entities.ChannelType: {
+			AddMembers:  []entities.Role{entities.RoleOwner, entities.RoleAdmin},
+			EditChat:    []entities.Role{entities.RoleOwner, entities.RoleAdmin},
+			CanLeave:    true,
+			Open:        true,
+			DefaultRole: entities.RoleSubscriber,
+			Broadcast:   true,
+		},
+	}
+}
+
+// LoadPolicies reads policies from JSON like {"group": {"max_members": 200}}.
+// Chat types and fields missing in it keep their defaults.
+func LoadPolicies(r io.Reader) (Policies, error) {
+	const op = "LoadPolicies"
+
+	loaded := make(map[entities.ChatType]json.RawMessage)
+	if err := json.NewDecoder(r).Decode(&loaded); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	res := DefaultPolicies()
+	for typ, data := range loaded {
+		p, ok := res[typ]
+		if !ok {
+			return nil, errors.Wrap(errors.Errorf("unknown chat type '%s'", typ), op)
+		}
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, errors.Wrapf(err, "%s: %s", op, typ)
+		}
+		if err := p.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "%s: %s", op, typ)
+		}
+	}
+	return res, nil
+}
+
+func containsRole(roles []entities.Role, role entities.Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/pkg/errors"
+)
+
+// authorizer decides what the current user may do in a chat.
+// All checks of the service are made by it and fail with chats.ErrForbidden.
+type authorizer struct {
+	chat   *entities.Chat
+	policy *chats.ChatPolicy
+	userID string
+	// role is the role of the user, nil if the user is not a member
+	role *entities.ChatRole
+}
+
+func (s *service) authorize(ctx context.Context, st chats.Storage, chat *entities.Chat) (*authorizer, error) {
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := s.policy(ctx, st, chat)
+	if err != nil {
+		return nil, err
+	}
+	role, err := memberChatRole(ctx, st, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &authorizer{chat: chat, policy: policy, userID: userID, role: role}, nil
+}
+
+func (s *service) authorizeChat(ctx context.Context, st chats.Storage, chatID string) (*authorizer, error) {
+	chat, err := st.GetChat(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return s.authorize(ctx, st, chat)
+}
+
+// authorizeDeleted authorizes the user in a deleted chat. Stored policies of deleted chats
+// are not available, the policy of the chat type is used instead.
+func (s *service) authorizeDeleted(ctx context.Context, st chats.Storage, chat *entities.Chat) (*authorizer, error) {
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy, ok := s.policies[chat.Type]
+	if !ok {
+		return nil, errors.Errorf("no policy for chat type '%s'", chat.Type)
+	}
+	role, err := memberChatRole(ctx, st, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &authorizer{chat: chat, policy: policy, userID: userID, role: role}, nil
+}
+
+func (a *authorizer) can(perm entities.Permission) bool {
+	return a.role != nil && a.policy.Permissions(a.role).Has(perm)
+}
+
+// isReader reports whether members with the role only read a broadcast chat.
+// Events about readers are private, and they do not see other members.
+func (a *authorizer) isReader(role *entities.ChatRole) bool {
+	return a.policy.Broadcast && a.policy.Permissions(role) == 0
+}
+
+func (a *authorizer) isOwner() bool {
+	return a.role != nil && a.role.Name == entities.RoleOwner
+}
+
+// canView allows members to see the chat, open chats are seen by anyone to join them.
+func (a *authorizer) canView() error {
+	if a.role == nil && !a.policy.Open {
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+func (a *authorizer) canViewMembers() error {
+	if a.role == nil || a.isReader(a.role) {
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+// canSubscribe allows anyone to join open chats by themselves.
+func (a *authorizer) canSubscribe() error {
+	if !a.policy.Open || a.chat.Type == entities.DialogType {
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+func (a *authorizer) canEdit() error {
+	if !a.can(entities.PermEditChat) {
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+func (a *authorizer) canDelete() error {
+	if !a.isOwner() {
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+func (a *authorizer) canManageRoles() error {
+	if !a.isOwner() {
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+// grantedRole returns the role the user gets when role is requested for them: the second
+// member of a dialog owns it too, users joining an open chat by themselves get the default role.
+func (a *authorizer) grantedRole(userID string, role entities.Role) entities.Role {
+	switch {
+	case a.chat.Type == entities.DialogType:
+		return entities.RoleOwner
+	case userID == a.userID && a.role == nil && a.policy.Open:
+		return a.policy.DefaultRole
+	}
+	return role
+}
+
+// canSetMember checks granting the role to the user having the current role, nil for new members.
+// Members manage members of lower ranks only, see canGrant for the roles they grant.
+func (a *authorizer) canSetMember(userID string, current, granted *entities.ChatRole) error {
+	switch {
+	case a.chat.Type == entities.DialogType:
+		// участники диалога не меняются, можно только добавить собеседника
+		if current != nil || !a.can(entities.PermInvite) {
+			return chats.ErrForbidden
+		}
+	case a.can(entities.PermInvite):
+		if !a.canGrant(granted, current == nil) || current != nil && a.role.Rank <= current.Rank {
+			return chats.ErrForbidden
+		}
+	case userID == a.userID && current == nil && a.policy.Open && granted.Name == a.policy.DefaultRole:
+	default:
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+// canGrant allows roles lower than the member's own. New members may also be invited
+// with the default role as high as it, so that members of groups invite members,
+// and owners make co-owners.
+func (a *authorizer) canGrant(role *entities.ChatRole, invite bool) bool {
+	switch {
+	case a.role.Rank > role.Rank:
+		return true
+	case invite && role.Name == a.policy.DefaultRole:
+		return a.role.Rank >= role.Rank
+	}
+	return a.isOwner() && role.Name == entities.RoleOwner
+}
+
+// canDeleteMember checks removing the user having the role from the chat.
+// Owners cannot be removed, they may leave if another owner remains.
+func (a *authorizer) canDeleteMember(userID string, role *entities.ChatRole, lastOwner bool) error {
+	switch {
+	case a.chat.Type == entities.DialogType:
+		return errors.Wrap(chats.ErrForbidden, "dialog members cannot be removed")
+	case role.Name == entities.RoleOwner && userID != a.userID:
+		return errors.Wrap(chats.ErrForbidden, "owner cannot be removed")
+	case role.Name == entities.RoleOwner && lastOwner:
+		return errors.Wrap(chats.ErrForbidden, "the last owner cannot leave")
+	case userID == a.userID:
+		if !a.policy.CanLeave {
+			return chats.ErrForbidden
+		}
+	case !a.can(entities.PermKick) || a.role.Rank <= role.Rank:
+		return chats.ErrForbidden
+	}
+	return nil
+}
+
+// canTransferOwnership checks making the user having the role an owner instead of the current one.
+func (a *authorizer) canTransferOwnership(role *entities.ChatRole) error {
+	switch {
+	case a.chat.Type == entities.DialogType:
+		return errors.Wrap(chats.ErrForbidden, "dialog ownership cannot be transferred")
+	case !a.isOwner():
+		return chats.ErrForbidden
+	case role.Name == entities.RoleOwner:
+		return errors.Wrap(chats.ErrForbidden, "the user is an owner already")
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"time"
+
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/services/events"
+)
+
+type Option func(s *service)
+
+// WithPublisher sets a publisher notified about chat and member changes.
+func WithPublisher(p events.Publisher) Option {
+	return func(s *service) {
+		s.events = p
+	}
+}
+
+// WithPolicies sets policies of chat types instead of chats.DefaultPolicies.
+func WithPolicies(policies chats.Policies) Option {
+	return func(s *service) {
+		s.policies = policies
+	}
+}
+
+// WithMessages enables deleting messages of purged chats.
+func WithMessages(messages chats.Messages) Option {
+	return func(s *service) {
+		s.messages = messages
+	}
+}
+
+// WithGracePeriod sets how long deleted chats can be restored instead of chats.DefaultGracePeriod.
+func WithGracePeriod(d time.Duration) Option {
+	return func(s *service) {
+		s.gracePeriod = d
+	}
+}
+
+// WithAvatarHosts limits hosts chat avatars are accepted from, see chats.ChatRules.
+func WithAvatarHosts(hosts ...string) Option {
+	return func(s *service) {
+		s.rules.AvatarHosts = hosts
+	}
+}
+
+// WithUsers enables filling in profiles of chat members.
+func WithUsers(users chats.Users) Option {
+	return func(s *service) {
+		s.users = users
+	}
+}
@@ -2,57 +2,71 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/alenapetraki/chat/auth"
 	"github.com/alenapetraki/chat/entities"
 	"github.com/alenapetraki/chat/services/chats"
-	"github.com/alenapetraki/chat/storage"
-	chatsstorage "github.com/alenapetraki/chat/storage/chats"
+	"github.com/alenapetraki/chat/services/events"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/errs"
 	"github.com/alenapetraki/chat/util/id"
+	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/pkg/errors" //todo: deprecated. choose another package
 )
 
 type service struct {
-	storage chats.Storage
+	storage     chats.Storage
+	events      events.Publisher
+	users       chats.Users
+	messages    chats.Messages
+	policies    chats.Policies
+	rules       chats.ChatRules
+	gracePeriod time.Duration
 }
 
-func New(storage chats.Storage) *service {
-	return &service{storage: storage}
+// purgeBatchSize is the number of deleted chats purged at once.
+const purgeBatchSize = 100
+
+func New(storage chats.Storage, opts ...Option) *service {
+	s := &service{
+		storage:     storage,
+		events:      events.NopPublisher,
+		policies:    chats.DefaultPolicies(),
+		gracePeriod: chats.DefaultGracePeriod,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *service) CreateChat(ctx context.Context, chat *entities.Chat) (*entities.Chat, error) {
 	const op = "ChatService.CreateChat"
 
-	if chat.Type == entities.GroupType || chat.Type == entities.ChannelType {
-		if chat.Name == "" {
-			return nil, errors.Wrap(errors.New("name required"), op)
-		}
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
 	}
-
-	if chat.Type == entities.DialogType {
-		chat.Name = ""
-		chat.Description = ""
-		chat.AvatarURL = ""
+	if chat == nil {
+		return nil, errors.Wrap(errs.Invalid("chat", "is required"), op)
 	}
 
-	if chat.Type != entities.DialogType && chat.Type != entities.GroupType && chat.Type != entities.ChannelType {
-		return nil, errors.Wrap(errors.New("unknown type"), op)
+	if err := s.rules.Validate(chat); err != nil {
+		return nil, errors.Wrap(errs.Validation(err), op)
 	}
 
-	var err error
 	chat.ID, err = id.NewULID()
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
 
-	if err := s.storage.RunTx(func(tx *storage.Transaction) error {
-
-		st := chatsstorage.New(tx)
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
 
 		if err := st.CreateChat(ctx, chat); err != nil {
 			return errors.Wrap(err, op)
 		}
-		if err := st.SetMember(ctx, chat.ID, auth.GetUserID(ctx), entities.RoleOwner); err != nil {
+		if _, err := st.SetMember(ctx, chat.ID, userID, entities.RoleOwner); err != nil {
 			return errors.Wrap(err, op)
 		}
 		return nil
@@ -60,85 +74,786 @@ func (s *service) CreateChat(ctx context.Context, chat *entities.Chat) (*entitie
 		return nil, errors.Wrap(err, op)
 	}
 
+	s.publish(ctx, &entities.Event{
+		Type:   entities.EventMemberAdded,
+		ChatID: chat.ID,
+		UserID: userID,
+		Role:   entities.RoleOwner,
+		Chat:   chat,
+	})
+
+	return chat, nil
+}
+
+func (s *service) GetOrCreateDialog(ctx context.Context, otherUserID string) (*entities.Chat, error) {
+	const op = "ChatService.GetOrCreateDialog"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if otherUserID == userID {
+		return nil, errors.Wrap(errs.Invalid("user_id", "cannot start a dialog with oneself"), op)
+	}
+	if s.users != nil {
+		users, err := s.users.GetUsers(ctx, []string{otherUserID})
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		if len(users) == 0 {
+			return nil, errors.Wrap(chats.ErrNotFound, op)
+		}
+	}
+
+	chat, err := s.storage.GetDialog(ctx, userID, otherUserID)
+	if err == nil {
+		return chat, nil
+	}
+	if !errors.Is(err, chats.ErrNotFound) {
+		return nil, errors.Wrap(err, op)
+	}
+
+	chatID, err := id.NewULID()
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	err = s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		if err := st.CreateChat(ctx, &entities.Chat{ID: chatID, Type: entities.DialogType}); err != nil {
+			return err
+		}
+		if err := st.SetDialogUsers(ctx, chatID, userID, otherUserID); err != nil {
+			return err
+		}
+		for _, memberID := range []string{userID, otherUserID} {
+			if _, err := st.SetMember(ctx, chatID, memberID, entities.RoleOwner); err != nil {
+				return err
+			}
+		}
+		chat, err = st.GetChat(ctx, chatID)
+		return err
+	})
+	if errors.Is(err, chats.ErrDialogExists) {
+		// диалог создан параллельно
+		chat, err = s.storage.GetDialog(ctx, userID, otherUserID)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		return chat, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	for _, memberID := range []string{userID, otherUserID} {
+		s.publish(ctx, &entities.Event{
+			Type:   entities.EventMemberAdded,
+			ChatID: chat.ID,
+			UserID: memberID,
+			Role:   entities.RoleOwner,
+			Chat:   chat,
+		})
+	}
+
 	return chat, nil
 }
 
 func (s *service) GetChat(ctx context.Context, chatID string) (*entities.Chat, error) {
 	const op = "ChatService.GetChat"
 
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
 	chat, err := s.storage.GetChat(ctx, chatID)
 	if err != nil {
 		return nil, errors.Wrap(err, op)
 	}
+	a, err := s.authorize(ctx, s.storage, chat)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if err := a.canView(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
 	return chat, nil
 }
 
 func (s *service) DeleteChat(ctx context.Context, chatID string) error {
 	const op = "ChatService.DeleteChat"
-	if _, err := s.storage.DeleteMembers(ctx, chatID); err != nil {
+
+	if _, err := auth.RequireUser(ctx); err != nil {
 		return errors.Wrap(err, op)
 	}
-	if err := s.storage.DeleteChat(ctx, chatID); err != nil {
+
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		chat, err := st.GetChatForUpdate(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		a, err := s.authorize(ctx, st, chat)
+		if err != nil {
+			return err
+		}
+		if err := a.canDelete(); err != nil {
+			return err
+		}
+		return st.DeleteChat(ctx, chatID)
+	}); err != nil {
 		return errors.Wrap(err, op)
 	}
+
+	s.publish(ctx, &entities.Event{
+		Type:   entities.EventChatDeleted,
+		ChatID: chatID,
+	})
+
 	return nil
 }
 
-func (s *service) UpdateChat(ctx context.Context, chat *entities.Chat) error {
+func (s *service) RestoreChat(ctx context.Context, chatID string) error {
+	const op = "ChatService.RestoreChat"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	var chat *entities.Chat
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		var err error
+		chat, err = st.GetDeletedChat(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		a, err := s.authorizeDeleted(ctx, st, chat)
+		if err != nil {
+			return err
+		}
+		if err := a.canDelete(); err != nil {
+			return err
+		}
+		if time.Since(*chat.DeletedAt) > s.gracePeriod {
+			return errors.Wrap(chats.ErrNotFound, "grace period expired")
+		}
+		return st.RestoreChat(ctx, chatID)
+	}); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	chat.DeletedAt = nil
+	s.publish(ctx, &entities.Event{
+		Type:   entities.EventChatRestored,
+		ChatID: chatID,
+		Chat:   chat,
+	})
+
+	return nil
+}
+
+func (s *service) UpdateChat(ctx context.Context, chatID string, update *chats.ChatUpdate) (*entities.Chat, error) {
 	const op = "ChatService.UpdateChat"
-	return errors.Wrap(s.storage.UpdateChat(ctx, chat), op)
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if update == nil {
+		return nil, errors.Wrap(errs.Invalid("update", "is required"), op)
+	}
+
+	var chat *entities.Chat
+	// the chat is locked, so concurrent updates of different fields do not overwrite each other
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		var err error
+		chat, err = st.GetChatForUpdate(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		a, err := s.authorize(ctx, st, chat)
+		if err != nil {
+			return err
+		}
+		if err := a.canEdit(); err != nil {
+			return err
+		}
+
+		update.Apply(chat)
+		if err := s.rules.Validate(chat); err != nil {
+			return errs.Validation(err)
+		}
+		return st.UpdateChat(ctx, chat)
+	}); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	s.publish(ctx, &entities.Event{
+		Type:   entities.EventChatUpdated,
+		ChatID: chat.ID,
+		Chat:   chat,
+	})
+
+	return chat, nil
 }
 
 func (s *service) SetMember(ctx context.Context, chatID, userID string, role entities.Role) error {
 	const op = "ChatService.SetMember"
 
-	// - получить тип чата
-	//   - диалог: можно добавить только еще одного владельца
-
-	chat, err := s.storage.GetChat(ctx, chatID)
-	if err != nil {
+	if _, err := auth.RequireUser(ctx); err != nil {
 		return errors.Wrap(err, op)
 	}
 
-	if chat.Type == entities.DialogType {
+	var private, added bool
+
+	// the chat is locked, so concurrent joins see each other's members
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
 
-		role, err = s.storage.GetRole(ctx, chatID, userID)
-		if err != nil && !errors.Is(err, chats.ErrNotFound) {
+		chat, err := st.GetChatForUpdate(ctx, chatID)
+		if err != nil {
 			return err
 		}
+		a, err := s.authorize(ctx, st, chat)
+		if err != nil {
+			return err
+		}
+
+		current, err := memberChatRole(ctx, st, chatID, userID)
+		if err != nil {
+			return err
+		}
+		role = a.grantedRole(userID, role)
+		granted, err := resolveRole(ctx, st, chatID, role)
+		if err != nil {
+			return err
+		}
+		if err := a.canSetMember(userID, current, granted); err != nil {
+			return err
+		}
+
+		if current == nil && a.policy.MaxMembers > 0 && chat.NumMembers >= a.policy.MaxMembers {
+			return chats.ErrMaxMembersNumExceeded
+		}
+
+		if chat.Type == entities.DialogType {
+			if err := st.SetDialogUsers(ctx, chatID, a.userID, userID); err != nil {
+				return err
+			}
+		}
 
-		if chat.NumMembers == 2 && role == "" {
-			return errors.Wrap(chats.ErrMaxMembersNumExceeded, op)
+		private = a.isReader(granted)
+		added, err = st.SetMember(ctx, chatID, userID, role)
+		if err != nil {
+			return err
 		}
 
-		role = entities.RoleOwner
+		if granted.Name == entities.RoleOwner && chat.Type != entities.DialogType {
+			return st.AddOwnershipChange(ctx, &entities.OwnershipChange{
+				ChatID:    chatID,
+				ToUserID:  userID,
+				Reason:    entities.OwnershipGranted,
+				CreatedAt: time.Now().UTC(),
+			})
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, op)
 	}
 
-	if chat.Type == entities.GroupType && chat.NumMembers >= chats.MaxGroupMembersAllowed-1 {
-		return errors.Wrap(chats.ErrMaxMembersNumExceeded, op)
+	event := entities.EventMemberAdded
+	if !added {
+		event = entities.EventMemberRoleChanged
 	}
+	s.publish(ctx, &entities.Event{
+		Type:    event,
+		ChatID:  chatID,
+		UserID:  userID,
+		Role:    role,
+		Private: private,
+	})
 
-	return s.storage.SetMember(ctx, chatID, userID, role)
+	return nil
 }
 
 func (s *service) DeleteMember(ctx context.Context, chatID, userID string) error {
 	const op = "ChatService.DeleteMember"
 
-	role, err := s.storage.GetRole(ctx, chatID, userID)
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	var private bool
+
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		chat, err := st.GetChatForUpdate(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		a, err := s.authorize(ctx, st, chat)
+		if err != nil {
+			return err
+		}
+
+		name, err := st.GetRole(ctx, chatID, userID)
+		if err != nil {
+			return err
+		}
+		role, err := resolveRole(ctx, st, chatID, name)
+		if err != nil {
+			return err
+		}
+		lastOwner, err := isLastOwner(ctx, st, chatID, name)
+		if err != nil {
+			return err
+		}
+		if err := a.canDeleteMember(userID, role, lastOwner); err != nil {
+			return err
+		}
+		private = a.isReader(role)
+
+		if name == entities.RoleOwner {
+			if err := st.AddOwnershipChange(ctx, &entities.OwnershipChange{
+				ChatID:     chatID,
+				FromUserID: userID,
+				Reason:     entities.OwnershipLeft,
+				CreatedAt:  time.Now().UTC(),
+			}); err != nil {
+				return err
+			}
+		}
+
+		_, err = st.DeleteMembers(ctx, chatID, userID)
+		return err
+	}); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.publish(ctx, &entities.Event{
+		Type:    entities.EventMemberRemoved,
+		ChatID:  chatID,
+		UserID:  userID,
+		Private: private,
+	})
+
+	return nil
+}
+
+func (s *service) Subscribe(ctx context.Context, chatID string) error {
+	const op = "ChatService.Subscribe"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	a, err := s.authorizeChat(ctx, s.storage, chatID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	if a.role != nil {
+		return nil
+	}
+	if err := a.canSubscribe(); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	// лимит участников проверяется только под блокировкой чата
+	if a.policy.MaxMembers > 0 {
+		return errors.Wrap(s.SetMember(ctx, chatID, a.userID, a.policy.DefaultRole), op)
+	}
+
+	var (
+		role  *entities.ChatRole
+		added bool
+	)
+	// участник и его счетчик добавляются вместе
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		role, err = resolveRole(ctx, st, chatID, a.policy.DefaultRole)
+		if err != nil {
+			return err
+		}
+		added, err = st.AddSubscriber(ctx, chatID, a.userID, role.Name)
+		return err
+	}); err != nil {
+		return errors.Wrap(err, op)
+	}
+	if !added {
+		return nil
+	}
+
+	s.publish(ctx, &entities.Event{
+		Type:    entities.EventMemberAdded,
+		ChatID:  chatID,
+		UserID:  a.userID,
+		Role:    role.Name,
+		Private: a.isReader(role),
+	})
+
+	return nil
+}
+
+func (s *service) Permissions(ctx context.Context, chatID string) (entities.Permission, error) {
+	const op = "ChatService.Permissions"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	a, err := s.authorizeChat(ctx, s.storage, chatID)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+	if a.role == nil {
+		return 0, errors.Wrap(chats.ErrNotFound, op)
+	}
+	return a.policy.Permissions(a.role), nil
+}
+
+func (s *service) SetChatRole(ctx context.Context, chatID string, role *entities.ChatRole) error {
+	const op = "ChatService.SetChatRole"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err := validation.ValidateStruct(role,
+		validation.Field(&role.Name, validation.Required, validation.Length(1, 32), validation.By(func(interface{}) error {
+			if entities.IsBuiltinRole(role.Name) {
+				return errors.New("must not be a built-in role")
+			}
+			return nil
+		})),
+		validation.Field(&role.Rank, validation.Min(1), validation.Max(entities.MaxCustomRoleRank)),
+		validation.Field(&role.Permissions, validation.Max(entities.PermAll)),
+	); err != nil {
+		return errors.Wrap(errs.Validation(err), op)
+	}
+
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		a, err := s.authorizeChat(ctx, st, chatID)
+		if err != nil {
+			return err
+		}
+		if err := a.canManageRoles(); err != nil {
+			return err
+		}
+		return st.SetChatRole(ctx, chatID, role)
+	}); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *service) DeleteChatRole(ctx context.Context, chatID string, name entities.Role) error {
+	const op = "ChatService.DeleteChatRole"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		a, err := s.authorizeChat(ctx, st, chatID)
+		if err != nil {
+			return err
+		}
+		if err := a.canManageRoles(); err != nil {
+			return err
+		}
+
+		members, _, err := st.FindChatMembers(ctx, chatID, &chats.FindChatMembersFilter{
+			Roles: []entities.Role{name},
+		}, &util.PaginationOptions{Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(members) > 0 {
+			return chats.ErrRoleInUse
+		}
+
+		return st.DeleteChatRole(ctx, chatID, name)
+	}); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *service) FindChatRoles(ctx context.Context, chatID string) ([]*entities.ChatRole, error) {
+	const op = "ChatService.FindChatRoles"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	a, err := s.authorizeChat(ctx, s.storage, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if err := a.canViewMembers(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	roles, err := s.storage.FindChatRoles(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return roles, nil
+}
+
+func (s *service) TransferOwnership(ctx context.Context, chatID, newOwnerID string) error {
+	const op = "ChatService.TransferOwnership"
+
+	userID, err := auth.RequireUser(ctx)
 	if err != nil {
 		return errors.Wrap(err, op)
 	}
-	if role == entities.RoleOwner {
-		// найти других владельцев, нельзя удалить только если владелец один
-		return errors.Wrap(errors.New("cannot delete owner"), op)
+
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		chat, err := st.GetChatForUpdate(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		a, err := s.authorize(ctx, st, chat)
+		if err != nil {
+			return err
+		}
+
+		name, err := st.GetRole(ctx, chatID, newOwnerID)
+		if err != nil {
+			return err
+		}
+		role, err := resolveRole(ctx, st, chatID, name)
+		if err != nil {
+			return err
+		}
+		if err := a.canTransferOwnership(role); err != nil {
+			return err
+		}
+
+		if _, err := st.SetMember(ctx, chatID, newOwnerID, entities.RoleOwner); err != nil {
+			return err
+		}
+		if _, err := st.SetMember(ctx, chatID, userID, entities.RoleAdmin); err != nil {
+			return err
+		}
+		return st.AddOwnershipChange(ctx, &entities.OwnershipChange{
+			ChatID:     chatID,
+			FromUserID: userID,
+			ToUserID:   newOwnerID,
+			Reason:     entities.OwnershipTransferred,
+			CreatedAt:  time.Now().UTC(),
+		})
+	}); err != nil {
+		return errors.Wrap(err, op)
 	}
 
-	_, err = s.storage.DeleteMembers(ctx, chatID, userID)
-	return errors.Wrap(err, op)
+	s.publish(ctx, &entities.Event{
+		Type:   entities.EventMemberRoleChanged,
+		ChatID: chatID,
+		UserID: newOwnerID,
+		Role:   entities.RoleOwner,
+	})
+	s.publish(ctx, &entities.Event{
+		Type:   entities.EventMemberRoleChanged,
+		ChatID: chatID,
+		UserID: userID,
+		Role:   entities.RoleAdmin,
+	})
+
+	return nil
+}
+
+func (s *service) FindOwnershipChanges(ctx context.Context, chatID string) ([]*entities.OwnershipChange, error) {
+	const op = "ChatService.FindOwnershipChanges"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	a, err := s.authorizeChat(ctx, s.storage, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if err := a.canViewMembers(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	changes, err := s.storage.FindOwnershipChanges(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return changes, nil
+}
+
+func (s *service) RemoveUser(ctx context.Context, userID string) error {
+	const op = "ChatService.RemoveUser"
+
+	callerID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	if callerID != userID {
+		return errors.Wrap(chats.ErrForbidden, op)
+	}
+
+	chatIDs, err := s.storage.FindMemberChatIDs(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	for _, chatID := range chatIDs {
+		var (
+			heir    *entities.ChatMember
+			private bool
+			removed bool
+		)
+
+		if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+			heir, removed = nil, false
+			chat, err := st.GetChatForUpdate(ctx, chatID)
+			if errors.Is(err, chats.ErrNotFound) {
+				// чат удален после поиска, из удаленных чатов пользователь удаляется ниже
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			a, err := s.authorize(ctx, st, chat)
+			if err != nil {
+				return err
+			}
+			if a.role == nil {
+				return chats.ErrNotFound
+			}
+			private = a.isReader(a.role)
+			role := a.role.Name
+
+			if role == entities.RoleOwner {
+				change := &entities.OwnershipChange{
+					ChatID:     chatID,
+					FromUserID: userID,
+					Reason:     entities.OwnershipLeft,
+					CreatedAt:  time.Now().UTC(),
+				}
+				lastOwner, err := isLastOwner(ctx, st, chatID, role)
+				if err != nil {
+					return err
+				}
+				if lastOwner {
+					// без администраторов чат остается без владельца
+					heir, err = st.GetOldestMember(ctx, chatID, entities.RoleAdmin)
+					if err != nil && !errors.Is(err, chats.ErrNotFound) {
+						return err
+					}
+				}
+				if heir != nil {
+					if _, err := st.SetMember(ctx, chatID, heir.UserID, entities.RoleOwner); err != nil {
+						return err
+					}
+					change.ToUserID = heir.UserID
+					change.Reason = entities.OwnershipInherited
+				}
+				if err := st.AddOwnershipChange(ctx, change); err != nil {
+					return err
+				}
+			}
+
+			removed = true
+			_, err = st.DeleteMembers(ctx, chatID, userID)
+			return err
+		}); err != nil {
+			return errors.Wrapf(err, "%s: chat %s", op, chatID)
+		}
+		if !removed {
+			continue
+		}
+
+		s.publish(ctx, &entities.Event{
+			Type:    entities.EventMemberRemoved,
+			ChatID:  chatID,
+			UserID:  userID,
+			Private: private,
+		})
+		if heir != nil {
+			s.publish(ctx, &entities.Event{
+				Type:   entities.EventMemberRoleChanged,
+				ChatID: chatID,
+				UserID: heir.UserID,
+				Role:   entities.RoleOwner,
+			})
+		}
+	}
+
+	if _, err := s.storage.DeleteMemberOfDeletedChats(ctx, userID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// isLastOwner reports whether the member having the role is the only owner of the chat.
+func isLastOwner(ctx context.Context, st chats.Storage, chatID string, role entities.Role) (bool, error) {
+	if role != entities.RoleOwner {
+		return false, nil
+	}
+	owners, _, err := st.FindChatMembers(ctx, chatID, &chats.FindChatMembersFilter{
+		Roles: []entities.Role{entities.RoleOwner},
+	}, &util.PaginationOptions{Limit: 2})
+	if err != nil {
+		return false, err
+	}
+	return len(owners) < 2, nil
+}
+
+// policy returns the policy of the chat, its own or the one of its type.
+func (s *service) policy(ctx context.Context, st chats.Storage, chat *entities.Chat) (*chats.ChatPolicy, error) {
+	policy, err := st.GetChatPolicy(ctx, chat.ID)
+	if err != nil || policy != nil {
+		return policy, err
+	}
+	if policy, ok := s.policies[chat.Type]; ok {
+		return policy, nil
+	}
+	return nil, errors.Errorf("no policy for chat type '%s'", chat.Type)
+}
+
+// resolveRole returns a built-in role or a custom role of the chat.
+func resolveRole(ctx context.Context, st chats.Storage, chatID string, name entities.Role) (*entities.ChatRole, error) {
+	if role, ok := entities.BuiltinRoles[name]; ok {
+		return role, nil
+	}
+	role, err := st.GetChatRole(ctx, chatID, name)
+	if errors.Is(err, chats.ErrNotFound) {
+		return nil, chats.ErrUnknownRole
+	}
+	return role, err
+}
+
+// memberChatRole returns the role of the user or nil if the user is not a member.
+func memberChatRole(ctx context.Context, st chats.Storage, chatID, userID string) (*entities.ChatRole, error) {
+	name, err := st.GetRole(ctx, chatID, userID)
+	if err != nil {
+		if errors.Is(err, chats.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return resolveRole(ctx, st, chatID, name)
 }
 
 func (s *service) GetRole(ctx context.Context, chatID, userID string) (entities.Role, error) {
 	const op = "ChatService.GetRole"
+
+	callerID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, op)
+	}
+	if userID != callerID {
+		a, err := s.authorizeChat(ctx, s.storage, chatID)
+		if err != nil {
+			return "", errors.Wrap(err, op)
+		}
+		if err := a.canViewMembers(); err != nil {
+			return "", errors.Wrap(err, op)
+		}
+	}
 	role, err := s.storage.GetRole(ctx, chatID, userID)
 	if err != nil {
 		return "", errors.Wrap(err, op)
@@ -146,6 +861,203 @@ func (s *service) GetRole(ctx context.Context, chatID, userID string) (entities.
 	return role, nil
 }
 
-//func (s *service) FindChatMembers(ctx context.Context, chatID string, options *commons.PaginationOptions) ([]*ChatMember, error) {
-//	return s.storage.FindChatMembers(ctx, chatID, options)
-//}
+func (s *service) FindChats(ctx context.Context, filter *chats.FindChatsFilter, options *util.PaginationOptions, sort *util.SortOptions) ([]*entities.Chat, *util.Page, error) {
+	const op = "ChatService.FindChats"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	if err := chats.ValidateSort(sort); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	f := chats.FindChatsFilter{}
+	if filter != nil {
+		f = *filter
+	}
+	f.MemberID = userID
+
+	res, page, err := s.storage.FindChats(ctx, &f, options, sort)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	return res, page, nil
+}
+
+func (s *service) FindChatMembers(ctx context.Context, chatID string, filter *chats.FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error) {
+	const op = "ChatService.FindChatMembers"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	a, err := s.authorizeChat(ctx, s.storage, chatID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	if err := a.canViewMembers(); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	members, page, err := s.storage.FindChatMembers(ctx, chatID, filter, options)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	if err := s.fillUsers(ctx, members); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	return members, page, nil
+}
+
+// ReconcileMemberCounts is a job fixing numbers of chat members, see chats.Jobs.
+// It is not authorized and must not be exposed to users.
+func (s *service) ReconcileMemberCounts(ctx context.Context) (int, error) {
+	const op = "ChatService.ReconcileMemberCounts"
+
+	n, err := s.storage.ReconcileMemberCounts(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+	return n, nil
+}
+
+// PurgeDeletedChats is a job deleting chats after their grace period, see chats.Jobs.
+// Each chat is checked again under a transaction, so that chats restored meanwhile are kept.
+// Messages are deleted before their chat, so that a failed run leaves the chat to be purged again.
+func (s *service) PurgeDeletedChats(ctx context.Context) (int, error) {
+	const op = "ChatService.PurgeDeletedChats"
+
+	var purged int
+	for {
+		cutoff := time.Now().UTC().Add(-s.gracePeriod)
+		ids, err := s.storage.FindDeletedChatIDs(ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, errors.Wrap(err, op)
+		}
+
+		for _, chatID := range ids {
+			deleted, err := s.purgeChat(ctx, chatID, cutoff)
+			if err != nil {
+				return purged, errors.Wrapf(err, "%s: chat %s", op, chatID)
+			}
+			if deleted {
+				purged++
+			}
+		}
+
+		if len(ids) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// SetChatPolicy is an administrative action overriding the policy of a chat, see chats.Jobs.
+// It is not authorized and must not be exposed to users.
+func (s *service) SetChatPolicy(ctx context.Context, chatID string, policy *chats.ChatPolicy) error {
+	const op = "ChatService.SetChatPolicy"
+
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return errors.Wrap(errs.Validation(err), op)
+		}
+	}
+
+	if err := s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		chat, err := st.GetChatForUpdate(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		if chat.Type == entities.DialogType {
+			return errs.Invalid("policy", "dialogs have the policy of their type")
+		}
+		return st.SetChatPolicy(ctx, chatID, policy)
+	}); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// purgeChat deletes messages of the chat and the chat itself if it is still deleted before the cutoff,
+// it reports whether the chat is deleted.
+func (s *service) purgeChat(ctx context.Context, chatID string, cutoff time.Time) (bool, error) {
+	expired, err := isExpired(ctx, s.storage, chatID, cutoff)
+	if err != nil || !expired {
+		return false, err
+	}
+
+	// чат после срока хранения не восстановить, поэтому сообщения удаляются первыми:
+	// при ошибке чат остается удаленным и будет найден следующим запуском
+	if s.messages != nil {
+		if _, err := s.messages.DeleteChatMessages(ctx, chatID); err != nil {
+			return false, err
+		}
+	}
+
+	var deleted bool
+	err = s.storage.RunTx(ctx, nil, func(st chats.Storage) error {
+		deleted = false
+		expired, err := isExpired(ctx, st, chatID, cutoff)
+		if err != nil || !expired {
+			return err
+		}
+		if err := st.DeleteChat(ctx, chatID, true); err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
+
+// isExpired reports whether the chat is deleted before the cutoff.
+func isExpired(ctx context.Context, st chats.Storage, chatID string, cutoff time.Time) (bool, error) {
+	chat, err := st.GetDeletedChat(ctx, chatID)
+	if errors.Is(err, chats.ErrNotFound) {
+		// чат восстановлен или уже удален
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return chat.DeletedAt.Before(cutoff), nil
+}
+
+// fillUsers sets public profiles of members if users are available.
+func (s *service) fillUsers(ctx context.Context, members []*entities.ChatMember) error {
+	if s.users == nil || len(members) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.UserID
+	}
+	users, err := s.users.GetUsers(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*entities.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = &entities.User{
+			ID:       u.ID,
+			Username: u.Username,
+			FullName: u.FullName,
+			Status:   u.Status,
+		}
+	}
+	for _, m := range members {
+		m.User = byID[m.UserID]
+	}
+	return nil
+}
+
+func (s *service) publish(ctx context.Context, event *entities.Event) {
+	event.CreatedAt = time.Now().UTC()
+	s.events.Publish(ctx, event)
+}
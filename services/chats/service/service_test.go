@@ -0,0 +1,944 @@
+package service_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/services/chats/service"
+	"github.com/alenapetraki/chat/services/events/hub"
+	chatsstorage "github.com/alenapetraki/chat/storage/chats"
+	"github.com/alenapetraki/chat/storage/chats/memory"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func storages(t *testing.T) map[string]func() chats.Storage {
+	res := map[string]func() chats.Storage{
+		"memory": func() chats.Storage { return memory.New() },
+	}
+	for _, driver := range storagetest.Drivers() {
+		driver := driver
+		res[driver] = func() chats.Storage {
+			db := storagetest.Connect(t, driver)
+			storagetest.Truncate(t, db)
+			return chatsstorage.New(db)
+		}
+	}
+	return res
+}
+
+// joinConcurrently adds n users to the chat in parallel and returns the number of them added.
+func joinConcurrently(ctx context.Context, t *testing.T, svc chats.Chats, chatID string, n int) int {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		added int
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			userID := "joiner_" + strconv.Itoa(i)
+			err := svc.SetMember(ctx, chatID, userID, entities.RoleMember)
+			if err != nil {
+				assert.ErrorIs(t, err, chats.ErrMaxMembersNumExceeded)
+				return
+			}
+			mu.Lock()
+			added++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return added
+}
+
+func TestSetMember_Concurrent(t *testing.T) {
+
+	const joiners = 20
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+
+			st := newStorage()
+			svc := service.New(st)
+			ctx := auth.WithUser(context.Background(), "owner")
+
+			t.Run("dialog", func(t *testing.T) {
+				dialog, err := svc.CreateChat(ctx, &entities.Chat{Type: entities.DialogType})
+				require.NoError(t, err)
+
+				assert.Equal(t, 1, joinConcurrently(ctx, t, svc, dialog.ID, joiners))
+
+				res, err := st.GetChat(ctx, dialog.ID)
+				require.NoError(t, err)
+				assert.Equal(t, 2, res.NumMembers)
+			})
+
+			t.Run("group", func(t *testing.T) {
+				group, err := svc.CreateChat(ctx, &entities.Chat{Type: entities.GroupType, Name: "group"})
+				require.NoError(t, err)
+
+				const free = 5
+				require.NoError(t, st.RunTx(ctx, nil, func(st chats.Storage) error {
+					for i := 1; i < chats.MaxGroupMembersAllowed-free; i++ {
+						if _, err := st.SetMember(ctx, group.ID, "member_"+strconv.Itoa(i), entities.RoleMember); err != nil {
+							return err
+						}
+					}
+					return nil
+				}))
+
+				assert.Equal(t, free, joinConcurrently(ctx, t, svc, group.ID, joiners))
+
+				res, err := st.GetChat(ctx, group.ID)
+				require.NoError(t, err)
+				assert.Equal(t, chats.MaxGroupMembersAllowed, res.NumMembers)
+
+				ms, _, err := st.FindChatMembers(ctx, group.ID, nil, nil)
+				require.NoError(t, err)
+				assert.Len(t, ms, chats.MaxGroupMembersAllowed)
+
+				err = svc.SetMember(ctx, group.ID, "one_more", entities.RoleMember)
+				assert.True(t, errors.Is(err, chats.ErrMaxMembersNumExceeded))
+			})
+		})
+	}
+}
+
+func updateName(svc chats.Chats, ctx context.Context, chatID, name string) error {
+	_, err := svc.UpdateChat(ctx, chatID, &chats.ChatUpdate{Name: &name})
+	return err
+}
+
+func TestCreateChat_Invalid(t *testing.T) {
+
+	svc := service.New(memory.New())
+	ctx := auth.WithUser(context.Background(), "user_1")
+
+	_, err := svc.CreateChat(ctx, &entities.Chat{Type: entities.GroupType})
+	assert.ErrorIs(t, err, errs.InvalidArgument)
+	assert.Equal(t, map[string]string{"name": "cannot be blank"}, errs.As(err).Fields)
+
+	_, err = svc.CreateChat(ctx, &entities.Chat{Type: "forum", Name: "forum"})
+	assert.ErrorIs(t, err, errs.InvalidArgument)
+	assert.Contains(t, errs.As(err).Fields, "type")
+
+	_, err = svc.CreateChat(ctx, nil)
+	assert.ErrorIs(t, err, errs.InvalidArgument, "Чат обязателен")
+	assert.Contains(t, errs.As(err).Fields, "chat")
+
+	_, err = svc.GetOrCreateDialog(ctx, "user_1")
+	assert.ErrorIs(t, err, errs.InvalidArgument)
+
+	err = svc.SetChatRole(ctx, "chat_1", &entities.ChatRole{Name: entities.RoleAdmin, Rank: 1000})
+	assert.ErrorIs(t, err, errs.InvalidArgument)
+	assert.Contains(t, errs.As(err).Fields, "Name")
+	assert.Contains(t, errs.As(err).Fields, "Rank")
+
+	_, err = svc.GetChat(ctx, "not_exist")
+	assert.ErrorIs(t, err, errs.NotFound)
+	assert.Equal(t, errs.NotFound, errs.CodeOf(err))
+}
+
+func TestUpdateChat(t *testing.T) {
+
+	svc := service.New(memory.New(), service.WithAvatarHosts("cdn.example.com"))
+	ctx := auth.WithUser(context.Background(), "user_1")
+
+	group, err := svc.CreateChat(ctx, &entities.Chat{
+		Type:        entities.GroupType,
+		Name:        "group",
+		Description: "about",
+		AvatarURL:   "https://img.cdn.example.com/1.png",
+	})
+	require.NoError(t, err)
+
+	description := "new description"
+	chat, err := svc.UpdateChat(ctx, group.ID, &chats.ChatUpdate{Description: &description})
+	require.NoError(t, err)
+	assert.Equal(t, "group", chat.Name, "Остальные поля не меняются")
+	assert.Equal(t, "new description", chat.Description)
+	assert.Equal(t, "https://img.cdn.example.com/1.png", chat.AvatarURL)
+
+	require.NoError(t, updateName(svc, ctx, group.ID, "renamed"))
+	chat, err = svc.GetChat(ctx, group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", chat.Name)
+	assert.Equal(t, "new description", chat.Description)
+
+	invalid := []struct {
+		field  string
+		update *chats.ChatUpdate
+	}{
+		{"name", &chats.ChatUpdate{Name: new(string)}},
+		{"name", &chats.ChatUpdate{Name: func() *string { s := strings.Repeat("я", chats.MaxNameLength+1); return &s }()}},
+		{"description", &chats.ChatUpdate{Description: func() *string { s := strings.Repeat("a", chats.MaxDescriptionLength+1); return &s }()}},
+		{"avatar_url", &chats.ChatUpdate{AvatarURL: func() *string { s := "http://cdn.example.com/1.png"; return &s }()}},
+		{"avatar_url", &chats.ChatUpdate{AvatarURL: func() *string { s := "https://evil.com/cdn.example.com.png"; return &s }()}},
+		{"avatar_url", &chats.ChatUpdate{AvatarURL: func() *string { s := "not a url"; return &s }()}},
+	}
+	for _, c := range invalid {
+		_, err := svc.UpdateChat(ctx, group.ID, c.update)
+		assert.ErrorIs(t, err, errs.InvalidArgument)
+		assert.Contains(t, errs.As(err).Fields, c.field)
+	}
+
+	chat, err = svc.GetChat(ctx, group.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed", chat.Name, "Неверные изменения не сохраняются")
+
+	empty := ""
+	chat, err = svc.UpdateChat(ctx, group.ID, &chats.ChatUpdate{AvatarURL: &empty})
+	require.NoError(t, err)
+	assert.Empty(t, chat.AvatarURL, "Аватар можно убрать")
+
+	_, err = svc.UpdateChat(ctx, group.ID, nil)
+	assert.ErrorIs(t, err, errs.InvalidArgument, "Изменения обязательны")
+
+	_, err = svc.CreateChat(ctx, &entities.Chat{Type: entities.DialogType, Name: "dialog"})
+	assert.ErrorIs(t, err, errs.InvalidArgument, "У диалога нет названия")
+}
+
+func TestPolicies(t *testing.T) {
+
+	policies, err := chats.LoadPolicies(strings.NewReader(`{"group": {"max_members": 3, "add_members": ["owner"], "edit_chat": ["owner", "member"]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, chats.DefaultPolicies()[entities.ChannelType], policies[entities.ChannelType])
+
+	st := memory.New()
+	svc := service.New(st, service.WithPolicies(policies))
+
+	owner := auth.WithUser(context.Background(), "owner")
+	member := auth.WithUser(context.Background(), "member")
+	stranger := auth.WithUser(context.Background(), "stranger")
+
+	t.Run("group", func(t *testing.T) {
+		group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+		require.NoError(t, err)
+		require.NoError(t, svc.SetMember(owner, group.ID, "member", entities.RoleMember))
+
+		err = svc.SetMember(member, group.ID, "friend", entities.RoleMember)
+		assert.ErrorIs(t, err, chats.ErrForbidden, "Добавлять участников может только владелец")
+		err = svc.SetMember(stranger, group.ID, "stranger", entities.RoleMember)
+		assert.ErrorIs(t, err, chats.ErrForbidden, "Группа не открытая")
+
+		require.NoError(t, svc.SetMember(owner, group.ID, "friend", entities.RoleMember))
+		err = svc.SetMember(owner, group.ID, "one_more", entities.RoleMember)
+		assert.ErrorIs(t, err, chats.ErrMaxMembersNumExceeded)
+
+		require.NoError(t, updateName(svc, member, group.ID, "renamed"))
+		err = updateName(svc, stranger, group.ID, "hacked")
+		assert.ErrorIs(t, err, chats.ErrForbidden)
+
+		err = svc.DeleteMember(member, group.ID, "friend")
+		assert.ErrorIs(t, err, chats.ErrForbidden)
+		require.NoError(t, svc.DeleteMember(member, group.ID, "member"), "Участник может выйти сам")
+	})
+
+	t.Run("override", func(t *testing.T) {
+		group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "premium"})
+		require.NoError(t, err)
+
+		premium := *policies[entities.GroupType]
+		premium.MaxMembers = 5
+		require.NoError(t, svc.SetChatPolicy(context.Background(), group.ID, &premium))
+
+		for i := 1; i < 5; i++ {
+			require.NoError(t, svc.SetMember(owner, group.ID, "member_"+strconv.Itoa(i), entities.RoleMember))
+		}
+		err = svc.SetMember(owner, group.ID, "one_more", entities.RoleMember)
+		assert.ErrorIs(t, err, chats.ErrMaxMembersNumExceeded)
+
+		invalid := premium
+		invalid.MaxMembers = -1
+		err = svc.SetChatPolicy(context.Background(), group.ID, &invalid)
+		assert.ErrorIs(t, err, errs.InvalidArgument)
+
+		require.NoError(t, svc.SetChatPolicy(context.Background(), group.ID, nil))
+		err = svc.SetMember(owner, group.ID, "member_5", entities.RoleMember)
+		assert.ErrorIs(t, err, chats.ErrMaxMembersNumExceeded, "Без переопределения действует политика группы")
+
+		dialog, err := svc.CreateChat(owner, &entities.Chat{Type: entities.DialogType})
+		require.NoError(t, err)
+		err = svc.SetChatPolicy(context.Background(), dialog.ID, &premium)
+		assert.ErrorIs(t, err, errs.InvalidArgument, "Политику диалога нельзя переопределить")
+	})
+
+	t.Run("channel", func(t *testing.T) {
+		channel, err := svc.CreateChat(owner, &entities.Chat{Type: entities.ChannelType, Name: "news"})
+		require.NoError(t, err)
+
+		require.NoError(t, svc.SetMember(stranger, channel.ID, "stranger", entities.RoleOwner))
+		role, err := st.GetRole(owner, channel.ID, "stranger")
+		require.NoError(t, err)
+		assert.Equal(t, entities.RoleSubscriber, role, "Вступивший сам становится подписчиком")
+
+		err = updateName(svc, stranger, channel.ID, "hacked")
+		assert.ErrorIs(t, err, chats.ErrForbidden)
+	})
+
+	t.Run("dialog", func(t *testing.T) {
+		dialog, err := svc.CreateChat(owner, &entities.Chat{Type: entities.DialogType})
+		require.NoError(t, err)
+		require.NoError(t, svc.SetMember(owner, dialog.ID, "member", entities.RoleMember))
+
+		err = svc.DeleteMember(member, dialog.ID, "member")
+		assert.ErrorIs(t, err, chats.ErrForbidden, "Из диалога нельзя выйти")
+	})
+
+	_, err = chats.LoadPolicies(strings.NewReader(`{"group": {"max_members": -1}}`))
+	assert.Error(t, err)
+	_, err = chats.LoadPolicies(strings.NewReader(`{"forum": {}}`))
+	assert.Error(t, err)
+}
+
+func TestRoles(t *testing.T) {
+
+	st := memory.New()
+	svc := service.New(st)
+
+	owner := auth.WithUser(context.Background(), "owner")
+	admin := auth.WithUser(context.Background(), "admin")
+	moderator := auth.WithUser(context.Background(), "moderator")
+	member := auth.WithUser(context.Background(), "member")
+
+	group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+	require.NoError(t, err)
+	require.NoError(t, svc.SetMember(owner, group.ID, "admin", entities.RoleAdmin))
+	require.NoError(t, svc.SetMember(admin, group.ID, "moderator", entities.RoleModerator))
+	require.NoError(t, svc.SetMember(moderator, group.ID, "member", entities.RoleMember))
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		userID string
+		role   entities.Role
+		err    error
+	}{
+		{name: "admin cannot grant admin", ctx: admin, userID: "new", role: entities.RoleAdmin, err: chats.ErrForbidden},
+		{name: "admin cannot make owners", ctx: admin, userID: "member", role: entities.RoleOwner, err: chats.ErrForbidden},
+		{name: "moderator cannot demote admin", ctx: moderator, userID: "admin", role: entities.RoleMember, err: chats.ErrForbidden},
+		{name: "member cannot promote itself", ctx: member, userID: "member", role: entities.RoleModerator, err: chats.ErrForbidden},
+		{name: "member invites subscribers", ctx: member, userID: "reader", role: entities.RoleSubscriber},
+		{name: "member invites members", ctx: member, userID: "friend", role: entities.RoleMember},
+		{name: "member cannot demote member", ctx: member, userID: "friend", role: entities.RoleSubscriber, err: chats.ErrForbidden},
+		{name: "moderator cannot grant moderator", ctx: moderator, userID: "new", role: entities.RoleModerator, err: chats.ErrForbidden},
+		{name: "unknown role", ctx: owner, userID: "new", role: "superuser", err: chats.ErrUnknownRole},
+		{name: "admin promotes member", ctx: admin, userID: "member", role: entities.RoleModerator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := svc.SetMember(tt.ctx, group.ID, tt.userID, tt.role)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			role, err := svc.GetRole(tt.ctx, group.ID, tt.userID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.role, role)
+		})
+	}
+
+	t.Run("kick", func(t *testing.T) {
+		assert.ErrorIs(t, svc.DeleteMember(moderator, group.ID, "member"), chats.ErrForbidden, "Роли равны")
+		assert.ErrorIs(t, svc.DeleteMember(moderator, group.ID, "admin"), chats.ErrForbidden)
+		require.NoError(t, svc.DeleteMember(admin, group.ID, "member"))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		editor := &entities.ChatRole{Name: "editor", Rank: 50, Permissions: entities.PermPost | entities.PermEditChat}
+
+		assert.ErrorIs(t, svc.SetChatRole(admin, group.ID, editor), chats.ErrForbidden, "Роли определяет только владелец")
+		assert.Error(t, svc.SetChatRole(owner, group.ID, &entities.ChatRole{Name: entities.RoleAdmin, Rank: 50}))
+		assert.Error(t, svc.SetChatRole(owner, group.ID, &entities.ChatRole{Name: "boss", Rank: 90}))
+		require.NoError(t, svc.SetChatRole(owner, group.ID, editor))
+
+		require.NoError(t, svc.SetMember(admin, group.ID, "editor", "editor"))
+		require.NoError(t, svc.SetMember(moderator, group.ID, "editor2", "editor"), "Модератор выше редактора")
+
+		editorCtx := auth.WithUser(context.Background(), "editor")
+		require.NoError(t, updateName(svc, editorCtx, group.ID, "edited"))
+		assert.ErrorIs(t, svc.SetMember(editorCtx, group.ID, "new", entities.RoleSubscriber), chats.ErrForbidden)
+
+		roles, err := svc.FindChatRoles(member, group.ID)
+		assert.ErrorIs(t, err, chats.ErrForbidden, "Участник был удален")
+		roles, err = svc.FindChatRoles(admin, group.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []*entities.ChatRole{editor}, roles)
+
+		assert.ErrorIs(t, svc.DeleteChatRole(owner, group.ID, "editor"), chats.ErrRoleInUse)
+		require.NoError(t, svc.DeleteMember(owner, group.ID, "editor"))
+		require.NoError(t, svc.DeleteMember(owner, group.ID, "editor2"))
+		require.NoError(t, svc.DeleteChatRole(owner, group.ID, "editor"))
+	})
+}
+
+func TestGetOrCreateDialog(t *testing.T) {
+
+	const callers = 10
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+
+			svc := service.New(newStorage())
+			alice := auth.WithUser(context.Background(), "alice")
+			bob := auth.WithUser(context.Background(), "bob")
+
+			// оба пользователя открывают диалог одновременно
+			var (
+				wg  sync.WaitGroup
+				ids = make([]string, callers)
+			)
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					ctx, other := alice, "bob"
+					if i%2 == 1 {
+						ctx, other = bob, "alice"
+					}
+					dialog, err := svc.GetOrCreateDialog(ctx, other)
+					if assert.NoError(t, err) {
+						ids[i] = dialog.ID
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			for _, id := range ids {
+				assert.Equal(t, ids[0], id, "Диалог должен быть один")
+			}
+			chat, err := svc.GetChat(bob, ids[0])
+			require.NoError(t, err)
+			assert.Equal(t, entities.DialogType, chat.Type)
+			assert.Equal(t, 2, chat.NumMembers)
+			role, err := svc.GetRole(bob, ids[0], "bob")
+			require.NoError(t, err)
+			assert.Equal(t, entities.RoleOwner, role)
+
+			_, err = svc.GetOrCreateDialog(alice, "alice")
+			assert.Error(t, err)
+
+			dialog, err := svc.CreateChat(alice, &entities.Chat{Type: entities.DialogType})
+			require.NoError(t, err)
+			err = svc.SetMember(alice, dialog.ID, "bob", entities.RoleOwner)
+			assert.ErrorIs(t, err, chats.ErrDialogExists, "Второй диалог тех же пользователей")
+			require.NoError(t, svc.SetMember(alice, dialog.ID, "carol", entities.RoleOwner))
+
+			carol := auth.WithUser(context.Background(), "carol")
+			found, err := svc.GetOrCreateDialog(carol, "alice")
+			require.NoError(t, err)
+			assert.Equal(t, dialog.ID, found.ID)
+		})
+	}
+}
+
+func TestChannel(t *testing.T) {
+
+	const subscribers = 30
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+
+			h := hub.New()
+			svc := service.New(newStorage(), service.WithPublisher(h))
+			owner := auth.WithUser(context.Background(), "owner")
+
+			channel, err := svc.CreateChat(owner, &entities.Chat{Type: entities.ChannelType, Name: "news"})
+			require.NoError(t, err)
+			require.NoError(t, svc.SetMember(owner, channel.ID, "admin", entities.RoleAdmin))
+
+			ownerEvents := h.Subscribe("owner", []string{channel.ID}, subscribers*2)
+			defer ownerEvents.Close()
+			readerEvents := h.Subscribe("reader_0", nil, subscribers*2)
+			defer readerEvents.Close()
+
+			var wg sync.WaitGroup
+			for i := 0; i < subscribers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					ctx := auth.WithUser(context.Background(), "reader_"+strconv.Itoa(i))
+					assert.NoError(t, svc.Subscribe(ctx, channel.ID))
+				}(i)
+			}
+			wg.Wait()
+
+			reader := auth.WithUser(context.Background(), "reader_0")
+			require.NoError(t, svc.Subscribe(reader, channel.ID), "Повторная подписка ничего не меняет")
+
+			got, err := svc.GetChat(owner, channel.ID)
+			require.NoError(t, err)
+			assert.Equal(t, subscribers+2, got.NumMembers)
+
+			role, err := svc.GetRole(reader, channel.ID, "reader_0")
+			require.NoError(t, err)
+			assert.Equal(t, entities.RoleSubscriber, role)
+			_, err = svc.GetRole(reader, channel.ID, "owner")
+			assert.ErrorIs(t, err, chats.ErrForbidden, "Подписчики не видят участников")
+			_, _, err = svc.FindChatMembers(reader, channel.ID, nil, nil)
+			assert.ErrorIs(t, err, chats.ErrForbidden)
+
+			perm, err := svc.Permissions(reader, channel.ID)
+			require.NoError(t, err)
+			assert.Equal(t, entities.Permission(0), perm)
+			perm, err = svc.Permissions(auth.WithUser(context.Background(), "admin"), channel.ID)
+			require.NoError(t, err)
+			assert.True(t, perm.Has(entities.PermPost))
+
+			select {
+			case e := <-ownerEvents.Events():
+				t.Fatalf("Владелец получил событие о подписчике: %+v", e)
+			default:
+			}
+			select {
+			case e := <-readerEvents.Events():
+				assert.Equal(t, entities.EventMemberAdded, e.Type)
+				assert.Equal(t, "reader_0", e.UserID)
+			default:
+				t.Fatal("Подписчик должен получить событие о себе")
+			}
+
+			require.NoError(t, svc.DeleteMember(reader, channel.ID, "reader_0"))
+			got, err = svc.GetChat(owner, channel.ID)
+			require.NoError(t, err)
+			assert.Equal(t, subscribers+1, got.NumMembers)
+		})
+	}
+}
+
+type recorder struct {
+	events []*entities.Event
+}
+
+func (r *recorder) Publish(_ context.Context, event *entities.Event) {
+	r.events = append(r.events, event)
+}
+
+func TestSetMember_Events(t *testing.T) {
+
+	events := new(recorder)
+	svc := service.New(memory.New(), service.WithPublisher(events))
+	owner := auth.WithUser(context.Background(), "owner")
+
+	group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+	require.NoError(t, err)
+	require.NoError(t, svc.SetMember(owner, group.ID, "member", entities.RoleMember))
+	require.NoError(t, svc.SetMember(owner, group.ID, "member", entities.RoleAdmin))
+	require.NoError(t, svc.TransferOwnership(owner, group.ID, "member"))
+
+	var got []string
+	for _, e := range events.events {
+		got = append(got, string(e.Type)+" "+e.UserID+" "+string(e.Role))
+	}
+	assert.Equal(t, []string{
+		"member_added owner owner",
+		"member_added member member",
+		"member_role_changed member admin",
+		"member_role_changed member owner",
+		"member_role_changed owner admin",
+	}, got, "Смена роли не считается новым участником")
+}
+
+func TestOwnership(t *testing.T) {
+
+	st := memory.New()
+	svc := service.New(st)
+
+	owner := auth.WithUser(context.Background(), "owner")
+	admin := auth.WithUser(context.Background(), "admin")
+	member := auth.WithUser(context.Background(), "member")
+
+	group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+	require.NoError(t, err)
+	require.NoError(t, svc.SetMember(owner, group.ID, "admin", entities.RoleAdmin))
+	require.NoError(t, svc.SetMember(owner, group.ID, "member", entities.RoleMember))
+
+	assert.ErrorIs(t, svc.DeleteMember(owner, group.ID, "owner"), chats.ErrForbidden, "Последний владелец не может выйти")
+	assert.ErrorIs(t, svc.TransferOwnership(admin, group.ID, "member"), chats.ErrForbidden)
+	assert.ErrorIs(t, svc.TransferOwnership(owner, group.ID, "stranger"), chats.ErrNotFound)
+
+	require.NoError(t, svc.TransferOwnership(owner, group.ID, "member"))
+	role, err := svc.GetRole(owner, group.ID, "member")
+	require.NoError(t, err)
+	assert.Equal(t, entities.RoleOwner, role)
+	role, err = svc.GetRole(owner, group.ID, "owner")
+	require.NoError(t, err)
+	assert.Equal(t, entities.RoleAdmin, role, "Прежний владелец становится администратором")
+
+	require.NoError(t, svc.SetMember(member, group.ID, "owner", entities.RoleMember))
+	require.NoError(t, svc.SetMember(member, group.ID, "admin2", entities.RoleAdmin))
+
+	dialog, err := svc.CreateChat(owner, &entities.Chat{Type: entities.DialogType})
+	require.NoError(t, err)
+	require.NoError(t, svc.SetMember(owner, dialog.ID, "member", entities.RoleMember))
+	assert.ErrorIs(t, svc.TransferOwnership(owner, dialog.ID, "member"), chats.ErrForbidden)
+
+	t.Run("another owner remains", func(t *testing.T) {
+		channel, err := svc.CreateChat(owner, &entities.Chat{Type: entities.ChannelType, Name: "news"})
+		require.NoError(t, err)
+		require.NoError(t, svc.SetMember(owner, channel.ID, "admin", entities.RoleAdmin))
+		assert.ErrorIs(t, svc.SetMember(admin, channel.ID, "admin", entities.RoleOwner), chats.ErrForbidden)
+		require.NoError(t, svc.SetMember(owner, channel.ID, "admin", entities.RoleOwner), "Владелец назначает совладельца")
+		assert.ErrorIs(t, svc.SetMember(admin, channel.ID, "owner", entities.RoleAdmin), chats.ErrForbidden, "Совладельца нельзя понизить")
+
+		assert.ErrorIs(t, svc.DeleteMember(admin, channel.ID, "owner"), chats.ErrForbidden, "Владельца нельзя удалить")
+		require.NoError(t, svc.DeleteMember(owner, channel.ID, "owner"), "Владелец выходит, пока остаётся другой")
+		assert.ErrorIs(t, svc.DeleteMember(admin, channel.ID, "admin"), chats.ErrForbidden, "Последний владелец не может выйти")
+
+		changes, err := svc.FindOwnershipChanges(admin, channel.ID)
+		require.NoError(t, err)
+		require.Len(t, changes, 2)
+		assert.Equal(t, entities.OwnershipGranted, changes[0].Reason)
+		assert.Equal(t, "admin", changes[0].ToUserID)
+		assert.Equal(t, entities.OwnershipLeft, changes[1].Reason)
+		assert.Equal(t, "owner", changes[1].FromUserID)
+	})
+
+	t.Run("account deleted", func(t *testing.T) {
+		assert.ErrorIs(t, svc.RemoveUser(owner, "member"), chats.ErrForbidden)
+		require.NoError(t, svc.RemoveUser(member, "member"))
+
+		role, err := svc.GetRole(admin, group.ID, "admin")
+		require.NoError(t, err)
+		assert.Equal(t, entities.RoleOwner, role, "Самый давний администратор становится владельцем")
+		role, err = svc.GetRole(admin, group.ID, "admin2")
+		require.NoError(t, err)
+		assert.Equal(t, entities.RoleAdmin, role)
+		_, err = svc.GetRole(admin, group.ID, "member")
+		assert.ErrorIs(t, err, chats.ErrNotFound)
+
+		_, err = svc.GetRole(owner, dialog.ID, "member")
+		assert.ErrorIs(t, err, chats.ErrNotFound)
+	})
+
+	changes, err := svc.FindOwnershipChanges(admin, group.ID)
+	require.NoError(t, err)
+	for _, c := range changes {
+		c.CreatedAt = time.Time{}
+	}
+	assert.Equal(t, []*entities.OwnershipChange{
+		{ChatID: group.ID, FromUserID: "owner", ToUserID: "member", Reason: entities.OwnershipTransferred},
+		{ChatID: group.ID, FromUserID: "member", ToUserID: "admin", Reason: entities.OwnershipInherited},
+	}, changes)
+
+	_, err = svc.FindOwnershipChanges(member, group.ID)
+	assert.ErrorIs(t, err, chats.ErrForbidden)
+}
+
+// messagesStub records chats whose messages are deleted, it fails with err.
+type messagesStub struct {
+	chatIDs []string
+	err     error
+}
+
+func (s *messagesStub) DeleteChatMessages(_ context.Context, chatID string) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.chatIDs = append(s.chatIDs, chatID)
+	return 1, nil
+}
+
+func TestDeleteChat_Lifecycle(t *testing.T) {
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			st := newStorage()
+			messages := new(messagesStub)
+			svc := service.New(st, service.WithMessages(messages), service.WithGracePeriod(time.Hour))
+			// сервис, у которого срок восстановления уже истек
+			expired := service.New(st, service.WithMessages(messages), service.WithGracePeriod(0))
+
+			owner := auth.WithUser(context.Background(), "owner")
+			member := auth.WithUser(context.Background(), "member")
+
+			group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+			require.NoError(t, err)
+			require.NoError(t, svc.SetMember(owner, group.ID, "member", entities.RoleMember))
+
+			assert.ErrorIs(t, svc.DeleteChat(member, group.ID), chats.ErrForbidden)
+			require.NoError(t, svc.DeleteChat(owner, group.ID))
+			_, err = svc.GetChat(member, group.ID)
+			assert.ErrorIs(t, err, chats.ErrNotFound)
+
+			assert.ErrorIs(t, svc.RestoreChat(member, group.ID), chats.ErrForbidden)
+			require.NoError(t, svc.RestoreChat(owner, group.ID))
+			got, err := svc.GetChat(member, group.ID)
+			require.NoError(t, err)
+			assert.Equal(t, 2, got.NumMembers, "Участники восстанавливаются вместе с чатом")
+
+			require.NoError(t, svc.DeleteChat(owner, group.ID))
+			n, err := svc.PurgeDeletedChats(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 0, n, "Срок восстановления не истек")
+
+			assert.ErrorIs(t, expired.RestoreChat(owner, group.ID), chats.ErrNotFound)
+			n, err = expired.PurgeDeletedChats(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+			assert.Equal(t, []string{group.ID}, messages.chatIDs)
+
+			assert.ErrorIs(t, svc.RestoreChat(owner, group.ID), chats.ErrNotFound)
+			_, err = st.GetRole(context.Background(), group.ID, "member")
+			assert.ErrorIs(t, err, chats.ErrNotFound, "Участники удаляются окончательно")
+		})
+	}
+}
+
+// restoringStorage restores deleted chats right after they are found to purge them.
+type restoringStorage struct {
+	chats.Storage
+}
+
+func (s restoringStorage) FindDeletedChatIDs(ctx context.Context, before time.Time, limit uint) ([]string, error) {
+	ids, err := s.Storage.FindDeletedChatIDs(ctx, before, limit)
+	for _, id := range ids {
+		if err := s.Storage.RestoreChat(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, err
+}
+
+func TestPurgeDeletedChats_Restored(t *testing.T) {
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			st := newStorage()
+			messages := new(messagesStub)
+			svc := service.New(restoringStorage{st}, service.WithMessages(messages), service.WithGracePeriod(0))
+
+			owner := auth.WithUser(context.Background(), "owner")
+			group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+			require.NoError(t, err)
+			require.NoError(t, svc.DeleteChat(owner, group.ID))
+
+			n, err := svc.PurgeDeletedChats(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 0, n, "Восстановленный чат не удаляется")
+			assert.Empty(t, messages.chatIDs, "Сообщения восстановленного чата сохраняются")
+
+			_, err = svc.GetChat(owner, group.ID)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPurgeDeletedChats_MessagesFailed(t *testing.T) {
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			st := newStorage()
+			messages := &messagesStub{err: errors.New("connection refused")}
+			svc := service.New(st, service.WithMessages(messages), service.WithGracePeriod(0))
+
+			owner := auth.WithUser(context.Background(), "owner")
+			group, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+			require.NoError(t, err)
+			require.NoError(t, svc.DeleteChat(owner, group.ID))
+
+			n, err := svc.PurgeDeletedChats(context.Background())
+			assert.ErrorIs(t, err, messages.err)
+			assert.Equal(t, 0, n)
+			_, err = st.GetDeletedChat(context.Background(), group.ID)
+			require.NoError(t, err, "Чат не удаляется, пока не удалены его сообщения")
+
+			messages.err = nil
+			n, err = svc.PurgeDeletedChats(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, n, "Следующий запуск удаляет чат")
+			assert.Equal(t, []string{group.ID}, messages.chatIDs)
+
+			_, err = st.GetDeletedChat(context.Background(), group.ID)
+			assert.ErrorIs(t, err, chats.ErrNotFound)
+		})
+	}
+}
+
+func TestRemoveUser_DeletedChat(t *testing.T) {
+
+	for name, newStorage := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			st := newStorage()
+			svc := service.New(st)
+
+			owner := auth.WithUser(context.Background(), "owner")
+			member := auth.WithUser(context.Background(), "member")
+
+			deleted, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "deleted"})
+			require.NoError(t, err)
+			require.NoError(t, svc.SetMember(owner, deleted.ID, "member", entities.RoleMember))
+			alive, err := svc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "alive"})
+			require.NoError(t, err)
+			require.NoError(t, svc.SetMember(owner, alive.ID, "member", entities.RoleMember))
+
+			require.NoError(t, svc.DeleteChat(owner, deleted.ID))
+			require.NoError(t, svc.RemoveUser(member, "member"))
+
+			_, err = svc.GetRole(owner, alive.ID, "member")
+			assert.ErrorIs(t, err, chats.ErrNotFound)
+
+			require.NoError(t, svc.RestoreChat(owner, deleted.ID))
+			_, err = svc.GetRole(owner, deleted.ID, "member")
+			assert.ErrorIs(t, err, chats.ErrNotFound, "Восстановленный чат не возвращает удаленного пользователя")
+			got, err := svc.GetChat(owner, deleted.ID)
+			require.NoError(t, err)
+			assert.Equal(t, 1, got.NumMembers)
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+
+	// newChat создает чат, где у каждого пользователя роль по его имени, target - подписчик
+	// группы или канала либо собеседник в диалоге
+	newChat := func(t *testing.T, svc chats.Chats, typ entities.ChatType) string {
+		owner := auth.WithUser(context.Background(), "owner")
+		chat := &entities.Chat{Type: typ, Name: "chat"}
+		if typ == entities.DialogType {
+			chat.Name = ""
+		}
+		chat, err := svc.CreateChat(owner, chat)
+		require.NoError(t, err)
+		if typ == entities.DialogType {
+			require.NoError(t, svc.SetMember(owner, chat.ID, "target", entities.RoleMember))
+			return chat.ID
+		}
+		for _, role := range []entities.Role{entities.RoleAdmin, entities.RoleModerator, entities.RoleMember, entities.RoleSubscriber} {
+			require.NoError(t, svc.SetMember(owner, chat.ID, string(role), role))
+		}
+		require.NoError(t, svc.SetMember(owner, chat.ID, "target", entities.RoleSubscriber))
+		return chat.ID
+	}
+
+	actions := map[string]func(ctx context.Context, svc chats.Chats, chatID string) error{
+		"view": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			_, err := svc.GetChat(ctx, chatID)
+			return err
+		},
+		"members": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			_, _, err := svc.FindChatMembers(ctx, chatID, nil, nil)
+			return err
+		},
+		"edit": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return updateName(svc, ctx, chatID, "renamed")
+		},
+		"delete": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.DeleteChat(ctx, chatID)
+		},
+		"add": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.SetMember(ctx, chatID, "new", entities.RoleMember)
+		},
+		"promote": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.SetMember(ctx, chatID, "target", entities.RoleMember)
+		},
+		"join": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.SetMember(ctx, chatID, auth.GetUserID(ctx), entities.RoleMember)
+		},
+		"subscribe": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.Subscribe(ctx, chatID)
+		},
+		"post": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			perm, err := svc.Permissions(ctx, chatID)
+			if err == nil && !perm.Has(entities.PermPost) {
+				err = chats.ErrForbidden
+			}
+			return err
+		},
+		"kick": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.DeleteMember(ctx, chatID, "target")
+		},
+		"leave": func(ctx context.Context, svc chats.Chats, chatID string) error {
+			return svc.DeleteMember(ctx, chatID, auth.GetUserID(ctx))
+		},
+	}
+
+	members := []string{"owner", "admin", "moderator", "member", "subscriber", "stranger"}
+
+	tests := []struct {
+		typ     entities.ChatType
+		action  string
+		allowed []string
+		// errs are errors of actors which are not allowed, ErrForbidden if missing
+		errs map[string]error
+	}{
+		{typ: entities.GroupType, action: "view", allowed: members[:5]},
+		{typ: entities.GroupType, action: "members", allowed: members[:5]},
+		{typ: entities.GroupType, action: "edit", allowed: []string{"owner", "admin"}},
+		{typ: entities.GroupType, action: "delete", allowed: []string{"owner"}},
+		{typ: entities.GroupType, action: "add", allowed: []string{"owner", "admin", "moderator", "member"}},
+		{typ: entities.GroupType, action: "promote", allowed: []string{"owner", "admin", "moderator"}},
+		{typ: entities.GroupType, action: "join"},
+		{typ: entities.GroupType, action: "subscribe", allowed: members[:5]},
+		{typ: entities.GroupType, action: "post", allowed: members[:4], errs: map[string]error{"stranger": chats.ErrNotFound}},
+		{typ: entities.GroupType, action: "kick", allowed: []string{"owner", "admin", "moderator"}},
+		{typ: entities.GroupType, action: "leave", allowed: members[1:5], errs: map[string]error{"stranger": chats.ErrNotFound}},
+
+		{typ: entities.ChannelType, action: "view", allowed: members},
+		{typ: entities.ChannelType, action: "members", allowed: []string{"owner", "admin", "moderator"}},
+		{typ: entities.ChannelType, action: "edit", allowed: []string{"owner", "admin"}},
+		{typ: entities.ChannelType, action: "delete", allowed: []string{"owner"}},
+		{typ: entities.ChannelType, action: "add", allowed: []string{"owner", "admin"}},
+		{typ: entities.ChannelType, action: "promote", allowed: []string{"owner", "admin"}},
+		{typ: entities.ChannelType, action: "join", allowed: []string{"stranger"}},
+		{typ: entities.ChannelType, action: "subscribe", allowed: members},
+		{typ: entities.ChannelType, action: "post", allowed: []string{"owner", "admin"}, errs: map[string]error{"stranger": chats.ErrNotFound}},
+		{typ: entities.ChannelType, action: "kick", allowed: []string{"owner", "admin", "moderator"}},
+		{typ: entities.ChannelType, action: "leave", allowed: members[1:5], errs: map[string]error{"stranger": chats.ErrNotFound}},
+
+		{typ: entities.DialogType, action: "view", allowed: []string{"owner", "target"}},
+		{typ: entities.DialogType, action: "members", allowed: []string{"owner", "target"}},
+		{typ: entities.DialogType, action: "edit"},
+		{typ: entities.DialogType, action: "delete", allowed: []string{"owner", "target"}},
+		{typ: entities.DialogType, action: "add", errs: map[string]error{"owner": chats.ErrMaxMembersNumExceeded, "target": chats.ErrMaxMembersNumExceeded}},
+		{typ: entities.DialogType, action: "promote"},
+		{typ: entities.DialogType, action: "join"},
+		{typ: entities.DialogType, action: "subscribe", allowed: []string{"owner", "target"}},
+		{typ: entities.DialogType, action: "post", allowed: []string{"owner", "target"}, errs: map[string]error{"stranger": chats.ErrNotFound}},
+		{typ: entities.DialogType, action: "kick"},
+		{typ: entities.DialogType, action: "leave", errs: map[string]error{"stranger": chats.ErrNotFound}},
+	}
+
+	for _, tt := range tests {
+		actors := members
+		if tt.typ == entities.DialogType {
+			actors = []string{"owner", "target", "stranger"}
+		}
+		for _, actor := range actors {
+			tt, actor := tt, actor
+			t.Run(string(tt.typ)+"/"+tt.action+"/"+actor, func(t *testing.T) {
+				svc := service.New(memory.New())
+				chatID := newChat(t, svc, tt.typ)
+
+				err := actions[tt.action](auth.WithUser(context.Background(), actor), svc, chatID)
+
+				allowed := false
+				for _, a := range tt.allowed {
+					allowed = allowed || a == actor
+				}
+				if allowed {
+					assert.NoError(t, err)
+					return
+				}
+				expected, ok := tt.errs[actor]
+				if !ok {
+					expected = chats.ErrForbidden
+				}
+				assert.ErrorIs(t, err, expected)
+			})
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package chats
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/alenapetraki/chat/entities"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/pkg/errors"
+)
+
+const (
+	MaxNameLength        = 255
+	MaxDescriptionLength = 1024
+)
+
+// ChatUpdate changes attributes of a chat, nil fields are left unchanged.
+type ChatUpdate struct {
+	Name        *string
+	Description *string
+	AvatarURL   *string
+}
+
+// Apply sets the changed attributes of the chat.
+func (u *ChatUpdate) Apply(chat *entities.Chat) {
+	if u.Name != nil {
+		chat.Name = *u.Name
+	}
+	if u.Description != nil {
+		chat.Description = *u.Description
+	}
+	if u.AvatarURL != nil {
+		chat.AvatarURL = *u.AvatarURL
+	}
+}
+
+// ChatRules validate attributes of chats.
+type ChatRules struct {
+	// AvatarHosts are hosts avatars are accepted from with their subdomains,
+	// avatars are accepted from any host if there are none.
+	AvatarHosts []string
+}
+
+// Validate checks the chat, its errors are validation.Errors by the names of fields in the API.
+// Dialogs have no name, description and avatar.
+func (r *ChatRules) Validate(chat *entities.Chat) error {
+	if chat.Type == entities.DialogType {
+		empty := validation.By(func(value interface{}) error {
+			if s, _ := value.(string); s != "" {
+				return errors.New("must be empty for dialogs")
+			}
+			return nil
+		})
+		return validation.Errors{
+			"name":        validation.Validate(chat.Name, empty),
+			"description": validation.Validate(chat.Description, empty),
+			"avatar_url":  validation.Validate(chat.AvatarURL, empty),
+		}.Filter()
+	}
+
+	return validation.Errors{
+		"type": validation.Validate(chat.Type, validation.Required, validation.In(
+			entities.DialogType,
+			entities.GroupType,
+			entities.ChannelType,
+		).Error("must be one of dialog, group or channel")),
+		"name":        validation.Validate(chat.Name, validation.Required, validation.RuneLength(1, MaxNameLength)),
+		"description": validation.Validate(chat.Description, validation.RuneLength(0, MaxDescriptionLength)),
+		"avatar_url":  validation.Validate(chat.AvatarURL, is.URL, validation.By(r.checkAvatar)),
+	}.Filter()
+}
+
+// checkAvatar accepts https URLs of the allowed hosts.
+func (r *ChatRules) checkAvatar(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" {
+		return errors.New("must be an https URL")
+	}
+	if len(r.AvatarHosts) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range r.AvatarHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return errors.New("host is not allowed")
+}
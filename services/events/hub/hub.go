@@ -0,0 +1,141 @@
+package hub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/alenapetraki/chat/entities"
+)
+
+// Hub delivers chat events to subscribers in memory.
+// Subscribers that do not keep up with events are dropped.
+type Hub struct {
+	mu    sync.RWMutex
+	chats map[string]map[*Subscription]struct{}
+	users map[string]map[*Subscription]struct{}
+}
+
+func New() *Hub {
+	return &Hub{
+		chats: make(map[string]map[*Subscription]struct{}),
+		users: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+type Subscription struct {
+	hub    *Hub
+	userID string
+	events chan *entities.Event
+	done   chan struct{}
+	once   sync.Once
+	chats  map[string]struct{}
+}
+
+// Events returns a channel of events delivered to the subscription.
+// It is never closed, use Done to detect the end of the subscription.
+func (s *Subscription) Events() <-chan *entities.Event {
+	return s.events
+}
+
+// Done is closed when the subscription is closed or dropped as a slow consumer.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		defer s.hub.mu.Unlock()
+
+		for chatID := range s.chats {
+			s.hub.unsubscribe(s, chatID)
+		}
+		delete(s.hub.users[s.userID], s)
+		if len(s.hub.users[s.userID]) == 0 {
+			delete(s.hub.users, s.userID)
+		}
+		close(s.done)
+	})
+}
+
+// Subscribe subscribes the user to events of the given chats. Membership changes
+// published afterwards are applied to the subscription automatically.
+func (h *Hub) Subscribe(userID string, chatIDs []string, buffer int) *Subscription {
+	s := &Subscription{
+		hub:    h,
+		userID: userID,
+		events: make(chan *entities.Event, buffer),
+		done:   make(chan struct{}),
+		chats:  make(map[string]struct{}, len(chatIDs)),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.users[userID] == nil {
+		h.users[userID] = make(map[*Subscription]struct{})
+	}
+	h.users[userID][s] = struct{}{}
+	for _, chatID := range chatIDs {
+		h.subscribe(s, chatID)
+	}
+
+	return s
+}
+
+func (h *Hub) Publish(_ context.Context, event *entities.Event) {
+
+	if event.Type == entities.EventMemberAdded {
+		h.mu.Lock()
+		for s := range h.users[event.UserID] {
+			h.subscribe(s, event.ChatID)
+		}
+		h.mu.Unlock()
+	}
+
+	var slow []*Subscription
+
+	h.mu.RLock()
+	targets := h.chats[event.ChatID]
+	if event.Private {
+		targets = h.users[event.UserID]
+	}
+	for s := range targets {
+		select {
+		case s.events <- event:
+		default:
+			slow = append(slow, s)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, s := range slow {
+		s.Close()
+	}
+
+	// Subscriptions to deleted chats are kept, so that members hear about them again
+	// once they are restored. Chats are not changed while they are deleted.
+	if event.Type == entities.EventMemberRemoved {
+		h.mu.Lock()
+		for s := range h.users[event.UserID] {
+			h.unsubscribe(s, event.ChatID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *Hub) subscribe(s *Subscription, chatID string) {
+	if h.chats[chatID] == nil {
+		h.chats[chatID] = make(map[*Subscription]struct{})
+	}
+	h.chats[chatID][s] = struct{}{}
+	s.chats[chatID] = struct{}{}
+}
+
+func (h *Hub) unsubscribe(s *Subscription, chatID string) {
+	delete(h.chats[chatID], s)
+	if len(h.chats[chatID]) == 0 {
+		delete(h.chats, chatID)
+	}
+	delete(s.chats, chatID)
+}
@@ -0,0 +1,122 @@
+package hub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(s *Subscription) *entities.Event {
+	select {
+	case e := <-s.Events():
+		return e
+	default:
+		return nil
+	}
+}
+
+func TestHub_Membership(t *testing.T) {
+
+	ctx := context.Background()
+	h := New()
+
+	sub := h.Subscribe("user_1", []string{"chat_1"}, 10)
+	defer sub.Close()
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_2"})
+	assert.Nil(t, receive(sub), "not subscribed to chat_2 yet")
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMemberAdded, ChatID: "chat_2", UserID: "user_1"})
+	e := receive(sub)
+	require.NotNil(t, e)
+	assert.Equal(t, entities.EventMemberAdded, e.Type)
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_2"})
+	require.NotNil(t, receive(sub))
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMemberRemoved, ChatID: "chat_2", UserID: "user_1"})
+	require.NotNil(t, receive(sub), "removed member must be notified")
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_2"})
+	assert.Nil(t, receive(sub))
+}
+
+func TestHub_RestoredChat(t *testing.T) {
+
+	ctx := context.Background()
+	h := New()
+
+	sub := h.Subscribe("user_1", []string{"chat_1"}, 10)
+	defer sub.Close()
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventChatDeleted, ChatID: "chat_1"})
+	require.NotNil(t, receive(sub))
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventChatRestored, ChatID: "chat_1"})
+	e := receive(sub)
+	require.NotNil(t, e, "members must be notified about the restored chat")
+	assert.Equal(t, entities.EventChatRestored, e.Type)
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_1"})
+	assert.NotNil(t, receive(sub), "events of the restored chat must be delivered")
+}
+
+func TestHub_SlowConsumer(t *testing.T) {
+
+	ctx := context.Background()
+	h := New()
+
+	slow := h.Subscribe("user_1", []string{"chat_1"}, 2)
+	fast := h.Subscribe("user_2", []string{"chat_1"}, 2)
+	defer fast.Close()
+
+	for i := 0; i < 3; i++ {
+		h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "chat_1"})
+		receive(fast)
+	}
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("slow subscription must be dropped")
+	}
+	select {
+	case <-fast.Done():
+		t.Fatal("fast subscription must stay")
+	default:
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	assert.Len(t, h.chats["chat_1"], 1)
+	assert.NotContains(t, h.users, "user_1")
+}
+
+func TestHub_Private(t *testing.T) {
+
+	ctx := context.Background()
+	h := New()
+
+	publisher := h.Subscribe("owner", []string{"channel"}, 10)
+	defer publisher.Close()
+	reader := h.Subscribe("reader", nil, 10)
+	defer reader.Close()
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMemberAdded, ChatID: "channel", UserID: "reader", Private: true})
+	require.NotNil(t, receive(reader))
+	assert.Nil(t, receive(publisher), "private events are not sent to other members")
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "channel"})
+	require.NotNil(t, receive(reader), "the member is subscribed to the chat")
+	require.NotNil(t, receive(publisher))
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMemberRemoved, ChatID: "channel", UserID: "reader", Private: true})
+	require.NotNil(t, receive(reader))
+	assert.Nil(t, receive(publisher))
+
+	h.Publish(ctx, &entities.Event{Type: entities.EventMessageCreated, ChatID: "channel"})
+	assert.Nil(t, receive(reader))
+}
@@ -0,0 +1,18 @@
+package events
+
+import (
+	"context"
+
+	"github.com/alenapetraki/chat/entities"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, event *entities.Event)
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, *entities.Event) {}
+
+// NopPublisher discards all events.
+var NopPublisher Publisher = nopPublisher{}
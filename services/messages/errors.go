@@ -0,0 +1,9 @@
+package messages
+
+import "github.com/alenapetraki/chat/util/errs"
+
+var (
+	ErrNotFound  = errs.New(errs.NotFound, "not found")
+	ErrNotMember = errs.New(errs.Forbidden, "user is not a member of the chat")
+	ErrForbidden = errs.New(errs.Forbidden, "operation is not permitted")
+)
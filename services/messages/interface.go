@@ -0,0 +1,50 @@
+package messages
+
+import (
+	"context"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/util"
+)
+
+const (
+	MaxMessageLength = 4096
+)
+
+type Messages interface {
+	SendMessage(ctx context.Context, chatID, body string) (*entities.Message, error)
+	GetMessage(ctx context.Context, chatID, messageID string) (*entities.Message, error)
+	ListMessages(ctx context.Context, chatID string, options *util.PaginationOptions) ([]*entities.Message, *util.Page, error)
+
+	EditMessage(ctx context.Context, chatID, messageID, body string) (*entities.Message, error)
+	DeleteMessage(ctx context.Context, chatID, messageID string) error
+	ListRevisions(ctx context.Context, chatID, messageID string) ([]*entities.MessageRevision, error)
+}
+
+type Storage interface {
+	Tx
+
+	CreateMessage(ctx context.Context, message *entities.Message) error
+	UpdateMessage(ctx context.Context, message *entities.Message) error
+	GetMessage(ctx context.Context, chatID, messageID string) (*entities.Message, error)
+	DeleteMessage(ctx context.Context, chatID, messageID string) error
+	FindMessages(ctx context.Context, chatID string, options *util.PaginationOptions) ([]*entities.Message, *util.Page, error)
+	// DeleteChatMessages removes all messages of the chat, it returns the number of messages removed.
+	DeleteChatMessages(ctx context.Context, chatID string) (int, error)
+
+	CreateRevision(ctx context.Context, revision *entities.MessageRevision) error
+	FindRevisions(ctx context.Context, messageID string) ([]*entities.MessageRevision, error)
+}
+
+type Tx interface {
+	// RunTx runs f with a storage bound to a transaction. The transaction is rolled back
+	// if f returns an error or panics. Calls on the bound storage start nested transactions.
+	RunTx(ctx context.Context, opts *storage.TxOptions, f func(st Storage) error) error
+}
+
+// Members is used to check permissions of the current user in chats, normally implemented by chats.Chats.
+type Members interface {
+	// Permissions fails with chats.ErrNotFound if the user is not a member.
+	Permissions(ctx context.Context, chatID string) (entities.Permission, error)
+}
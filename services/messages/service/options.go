@@ -0,0 +1,12 @@
+package service
+
+import "github.com/alenapetraki/chat/services/events"
+
+type Option func(s *service)
+
+// WithPublisher sets a publisher notified about new, edited and deleted messages.
+func WithPublisher(p events.Publisher) Option {
+	return func(s *service) {
+		s.events = p
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/services/events"
+	"github.com/alenapetraki/chat/services/messages"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/alenapetraki/chat/util/id"
+	"github.com/pkg/errors"
+)
+
+type service struct {
+	storage messages.Storage
+	members messages.Members
+	events  events.Publisher
+}
+
+func New(storage messages.Storage, members messages.Members, opts ...Option) *service {
+	s := &service{
+		storage: storage,
+		members: members,
+		events:  events.NopPublisher,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *service) SendMessage(ctx context.Context, chatID, body string) (*entities.Message, error) {
+	const op = "MessageService.SendMessage"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if err := validateBody(body); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	perm, err := s.permissions(ctx, chatID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if !perm.Has(entities.PermPost) {
+		return nil, errors.Wrap(messages.ErrForbidden, op)
+	}
+
+	msgID, err := id.NewULID()
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	msg := &entities.Message{
+		ID:        msgID,
+		ChatID:    chatID,
+		UserID:    userID,
+		Body:      body,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.storage.CreateMessage(ctx, msg); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	s.publish(ctx, entities.EventMessageCreated, msg)
+
+	return msg, nil
+}
+
+func (s *service) GetMessage(ctx context.Context, chatID, messageID string) (*entities.Message, error) {
+	const op = "MessageService.GetMessage"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	if _, err := s.permissions(ctx, chatID); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	msg, err := s.storage.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return msg, nil
+}
+
+func (s *service) ListMessages(ctx context.Context, chatID string, options *util.PaginationOptions) ([]*entities.Message, *util.Page, error) {
+	const op = "MessageService.ListMessages"
+
+	if _, err := auth.RequireUser(ctx); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	if _, err := s.permissions(ctx, chatID); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	msgs, page, err := s.storage.FindMessages(ctx, chatID, options)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	return msgs, page, nil
+}
+
+func (s *service) EditMessage(ctx context.Context, chatID, messageID, body string) (*entities.Message, error) {
+	const op = "MessageService.EditMessage"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if err := validateBody(body); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	var msg *entities.Message
+	if err := s.storage.RunTx(ctx, nil, func(st messages.Storage) error {
+
+		var err error
+		msg, err = st.GetMessage(ctx, chatID, messageID)
+		if err != nil {
+			return err
+		}
+		// moderators may delete messages of others, but not rewrite them
+		if _, err := s.permissions(ctx, msg.ChatID); err != nil {
+			return err
+		}
+		if msg.UserID != userID {
+			return messages.ErrForbidden
+		}
+
+		now := time.Now().UTC()
+		if err := st.CreateRevision(ctx, &entities.MessageRevision{
+			MessageID: msg.ID,
+			EditorID:  userID,
+			Body:      msg.Body,
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+
+		msg.Body = body
+		msg.EditedAt = &now
+		return st.UpdateMessage(ctx, msg)
+	}); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	s.publish(ctx, entities.EventMessageEdited, msg)
+
+	return msg, nil
+}
+
+func (s *service) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	const op = "MessageService.DeleteMessage"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	msg, err := s.storage.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	if err := s.checkAuthorOrModerator(ctx, msg, userID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err := s.storage.DeleteMessage(ctx, chatID, messageID); err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	s.publish(ctx, entities.EventMessageDeleted, &entities.Message{ID: msg.ID, ChatID: msg.ChatID, UserID: msg.UserID})
+
+	return nil
+}
+
+func (s *service) ListRevisions(ctx context.Context, chatID, messageID string) ([]*entities.MessageRevision, error) {
+	const op = "MessageService.ListRevisions"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	msg, err := s.storage.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	if err := s.checkAuthorOrModerator(ctx, msg, userID); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	revs, err := s.storage.FindRevisions(ctx, messageID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return revs, nil
+}
+
+// checkAuthorOrModerator allows access to the message author and members
+// who may delete messages of others only.
+func (s *service) checkAuthorOrModerator(ctx context.Context, msg *entities.Message, userID string) error {
+	perm, err := s.permissions(ctx, msg.ChatID)
+	if err != nil {
+		return err
+	}
+	if msg.UserID != userID && !perm.Has(entities.PermDeleteMessages) {
+		return messages.ErrForbidden
+	}
+	return nil
+}
+
+// permissions returns permissions of the current user, ErrNotMember if the user is not a member.
+func (s *service) permissions(ctx context.Context, chatID string) (entities.Permission, error) {
+	perm, err := s.members.Permissions(ctx, chatID)
+	if err != nil {
+		if errors.Is(err, chats.ErrNotFound) {
+			return 0, messages.ErrNotMember
+		}
+		return 0, err
+	}
+	return perm, nil
+}
+
+func (s *service) publish(ctx context.Context, typ entities.EventType, msg *entities.Message) {
+	s.events.Publish(ctx, &entities.Event{
+		Type:      typ,
+		ChatID:    msg.ChatID,
+		Message:   msg,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+func validateBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errs.Invalid("body", "cannot be blank")
+	}
+	if utf8.RuneCountInString(body) > messages.MaxMessageLength {
+		return errs.Invalid("body", "is too long")
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	chatsservice "github.com/alenapetraki/chat/services/chats/service"
+	"github.com/alenapetraki/chat/services/messages"
+	"github.com/alenapetraki/chat/services/messages/service"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/chats/memory"
+	messagesstorage "github.com/alenapetraki/chat/storage/messages"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	owner     = auth.WithUser(context.Background(), "owner")
+	moderator = auth.WithUser(context.Background(), "moderator")
+	member    = auth.WithUser(context.Background(), "member")
+	reader    = auth.WithUser(context.Background(), "reader")
+	stranger  = auth.WithUser(context.Background(), "stranger")
+)
+
+// setup returns the messages service with a group of the owner, the moderator and the member
+// and a channel of the owner read by the reader.
+func setup(t *testing.T, driver string) (svc messages.Messages, group, channel *entities.Chat) {
+
+	db := storagetest.Connect(t, driver)
+	storagetest.Truncate(t, db)
+
+	chatsSvc := chatsservice.New(memory.New())
+
+	group, err := chatsSvc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+	require.NoError(t, err)
+	require.NoError(t, chatsSvc.SetMember(owner, group.ID, "moderator", entities.RoleModerator))
+	require.NoError(t, chatsSvc.SetMember(owner, group.ID, "member", entities.RoleMember))
+
+	channel, err = chatsSvc.CreateChat(owner, &entities.Chat{Type: entities.ChannelType, Name: "news"})
+	require.NoError(t, err)
+	require.NoError(t, chatsSvc.SetMember(owner, channel.ID, "reader", entities.RoleSubscriber))
+
+	return service.New(messagesstorage.New(db), chatsSvc), group, channel
+}
+
+func TestSendMessage(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc, group, channel := setup(t, driver)
+
+			msg, err := svc.SendMessage(member, group.ID, "hello")
+			require.NoError(t, err)
+			assert.Equal(t, "member", msg.UserID)
+			assert.Equal(t, group.ID, msg.ChatID)
+
+			_, err = svc.SendMessage(context.Background(), group.ID, "hello")
+			assert.ErrorIs(t, err, errs.Unauthenticated)
+
+			_, err = svc.SendMessage(context.Background(), group.ID, " ")
+			assert.ErrorIs(t, err, errs.Unauthenticated, "Аутентификация проверяется до тела сообщения")
+
+			_, err = svc.SendMessage(stranger, group.ID, "hello")
+			assert.ErrorIs(t, err, messages.ErrNotMember, "Не участник не может писать в чат")
+
+			_, err = svc.SendMessage(member, group.ID, " ")
+			assert.ErrorIs(t, err, errs.InvalidArgument)
+
+			_, err = svc.SendMessage(reader, channel.ID, "hello")
+			assert.ErrorIs(t, err, messages.ErrForbidden, "Подписчик канала не может писать")
+
+			_, err = svc.SendMessage(owner, channel.ID, "news")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestGetMessage(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc, group, channel := setup(t, driver)
+
+			msg, err := svc.SendMessage(owner, group.ID, "hello")
+			require.NoError(t, err)
+
+			res, err := svc.GetMessage(member, group.ID, msg.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", res.Body)
+
+			_, err = svc.GetMessage(stranger, group.ID, msg.ID)
+			assert.ErrorIs(t, err, messages.ErrNotMember, "Не участник не видит сообщения чата")
+
+			_, err = svc.GetMessage(reader, group.ID, msg.ID)
+			assert.ErrorIs(t, err, messages.ErrNotMember, "Подписчик канала не видит сообщения других чатов")
+
+			news, err := svc.SendMessage(owner, channel.ID, "news")
+			require.NoError(t, err)
+
+			res, err = svc.GetMessage(reader, channel.ID, news.ID)
+			require.NoError(t, err, "Подписчик читает канал")
+			assert.Equal(t, "news", res.Body)
+
+			_, err = svc.GetMessage(reader, channel.ID, msg.ID)
+			assert.ErrorIs(t, err, errs.NotFound, "Сообщение ищется только в указанном чате")
+		})
+	}
+}
+
+func TestListMessages(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc, group, channel := setup(t, driver)
+
+			for _, body := range []string{"one", "two"} {
+				_, err := svc.SendMessage(member, group.ID, body)
+				require.NoError(t, err)
+			}
+			_, err := svc.SendMessage(owner, channel.ID, "news")
+			require.NoError(t, err)
+
+			res, _, err := svc.ListMessages(owner, group.ID, nil)
+			require.NoError(t, err)
+			assert.Len(t, res, 2)
+
+			_, _, err = svc.ListMessages(stranger, group.ID, nil)
+			assert.ErrorIs(t, err, messages.ErrNotMember, "Не участник не видит сообщения чата")
+
+			_, _, err = svc.ListMessages(reader, group.ID, nil)
+			assert.ErrorIs(t, err, messages.ErrNotMember)
+
+			res, _, err = svc.ListMessages(reader, channel.ID, nil)
+			require.NoError(t, err, "Подписчик читает канал")
+			require.Len(t, res, 1)
+			assert.Equal(t, "news", res[0].Body)
+		})
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc, group, _ := setup(t, driver)
+
+			msg, err := svc.SendMessage(member, group.ID, "hello")
+			require.NoError(t, err)
+
+			_, err = svc.EditMessage(moderator, group.ID, msg.ID, "edited")
+			assert.ErrorIs(t, err, messages.ErrForbidden, "Модератор не может править чужие сообщения")
+
+			_, err = svc.EditMessage(owner, group.ID, msg.ID, "edited")
+			assert.ErrorIs(t, err, messages.ErrForbidden, "Править можно только свои сообщения")
+
+			_, err = svc.EditMessage(stranger, group.ID, msg.ID, "edited")
+			assert.ErrorIs(t, err, messages.ErrNotMember)
+
+			_, err = svc.EditMessage(context.Background(), group.ID, msg.ID, " ")
+			assert.ErrorIs(t, err, errs.Unauthenticated, "Аутентификация проверяется до тела сообщения")
+
+			res, err := svc.EditMessage(member, group.ID, msg.ID, "edited")
+			require.NoError(t, err)
+			assert.Equal(t, "edited", res.Body)
+			assert.NotNil(t, res.EditedAt)
+
+			_, err = svc.EditMessage(member, group.ID, msg.ID, "edited twice")
+			require.NoError(t, err)
+
+			res, err = svc.GetMessage(owner, group.ID, msg.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "edited twice", res.Body)
+
+			revs, err := svc.ListRevisions(member, group.ID, msg.ID)
+			require.NoError(t, err)
+			require.Len(t, revs, 2, "Каждая правка сохраняет прежний текст")
+			assert.Equal(t, "hello", revs[0].Body)
+			assert.Equal(t, "edited", revs[1].Body)
+			assert.Equal(t, "member", revs[0].EditorID)
+
+			revs, err = svc.ListRevisions(moderator, group.ID, msg.ID)
+			require.NoError(t, err, "Модератор видит правки чужих сообщений")
+			assert.Len(t, revs, 2)
+		})
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc, group, _ := setup(t, driver)
+
+			msg, err := svc.SendMessage(owner, group.ID, "hello")
+			require.NoError(t, err)
+
+			err = svc.DeleteMessage(member, group.ID, msg.ID)
+			assert.ErrorIs(t, err, messages.ErrForbidden, "Без PermDeleteMessages нельзя удалять чужие сообщения")
+
+			_, err = svc.ListRevisions(member, group.ID, msg.ID)
+			assert.ErrorIs(t, err, messages.ErrForbidden)
+
+			err = svc.DeleteMessage(stranger, group.ID, msg.ID)
+			assert.ErrorIs(t, err, messages.ErrNotMember)
+
+			_, err = svc.GetMessage(owner, group.ID, msg.ID)
+			require.NoError(t, err, "Сообщение не удалено")
+
+			own, err := svc.SendMessage(member, group.ID, "mine")
+			require.NoError(t, err)
+			require.NoError(t, svc.DeleteMessage(member, group.ID, own.ID), "Автор удаляет своё сообщение")
+
+			require.NoError(t, svc.DeleteMessage(owner, group.ID, msg.ID))
+			_, err = svc.GetMessage(owner, group.ID, msg.ID)
+			assert.ErrorIs(t, err, errs.NotFound)
+		})
+	}
+}
+
+// storageStub keeps messages in memory, it fails updates with err.
+type storageStub struct {
+	messages.Storage
+	msgs map[string]*entities.Message
+	revs []*entities.MessageRevision
+	err  error
+}
+
+func (s *storageStub) RunTx(_ context.Context, _ *storage.TxOptions, f func(st messages.Storage) error) error {
+	return f(s)
+}
+
+func (s *storageStub) CreateMessage(_ context.Context, msg *entities.Message) error {
+	m := *msg
+	s.msgs[msg.ID] = &m
+	return nil
+}
+
+func (s *storageStub) GetMessage(_ context.Context, chatID, messageID string) (*entities.Message, error) {
+	msg, ok := s.msgs[messageID]
+	if !ok || msg.ChatID != chatID {
+		return nil, messages.ErrNotFound
+	}
+	m := *msg
+	return &m, nil
+}
+
+func (s *storageStub) UpdateMessage(_ context.Context, msg *entities.Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	m := *msg
+	s.msgs[msg.ID] = &m
+	return nil
+}
+
+func (s *storageStub) CreateRevision(_ context.Context, rev *entities.MessageRevision) error {
+	s.revs = append(s.revs, rev)
+	return nil
+}
+
+type eventsStub []*entities.Event
+
+func (e *eventsStub) Publish(_ context.Context, event *entities.Event) {
+	*e = append(*e, event)
+}
+
+func TestEditMessage_Failed(t *testing.T) {
+
+	chatsSvc := chatsservice.New(memory.New())
+	group, err := chatsSvc.CreateChat(owner, &entities.Chat{Type: entities.GroupType, Name: "group"})
+	require.NoError(t, err)
+
+	st := &storageStub{msgs: make(map[string]*entities.Message)}
+	events := new(eventsStub)
+	svc := service.New(st, chatsSvc, service.WithPublisher(events))
+
+	msg, err := svc.SendMessage(owner, group.ID, "hello")
+	require.NoError(t, err)
+	require.Len(t, *events, 1)
+
+	st.err = errors.New("connection refused")
+	_, err = svc.EditMessage(owner, group.ID, msg.ID, "edited")
+	assert.ErrorIs(t, err, st.err)
+	assert.Len(t, *events, 1, "Неудачная правка не публикуется")
+	assert.Equal(t, "hello", st.msgs[msg.ID].Body)
+}
@@ -0,0 +1,9 @@
+package users
+
+import "github.com/alenapetraki/chat/util/errs"
+
+var (
+	ErrNotFound           = errs.New(errs.NotFound, "not found")
+	ErrAlreadyExists      = errs.New(errs.Conflict, "username or email is already taken")
+	ErrInvalidCredentials = errs.New(errs.Unauthenticated, "invalid username or password")
+)
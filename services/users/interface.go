@@ -0,0 +1,33 @@
+package users
+
+import (
+	"context"
+
+	"github.com/alenapetraki/chat/entities"
+)
+
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72 // bcrypt ignores the rest
+)
+
+type Users interface {
+	// Register creates a user with a plaintext password given in user.Password.
+	// Usernames and emails are kept in lower case.
+	Register(ctx context.Context, user *entities.User) (*entities.User, error)
+	// Authenticate finds the user by username regardless of case.
+	Authenticate(ctx context.Context, username, password string) (*entities.User, error)
+	// GetUser returns only the ID and username of users other than the current one.
+	GetUser(ctx context.Context, userID string) (*entities.User, error)
+	UpdateProfile(ctx context.Context, user *entities.User) (*entities.User, error)
+	ChangePassword(ctx context.Context, oldPassword, newPassword string) error
+}
+
+// Storage keeps users with password hashes in the Password field.
+type Storage interface {
+	CreateUser(ctx context.Context, user *entities.User) error
+	GetUser(ctx context.Context, userID string) (*entities.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*entities.User, error)
+	UpdateUser(ctx context.Context, user *entities.User) error
+	UpdatePassword(ctx context.Context, userID, password string) error
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/users"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/alenapetraki/chat/util/id"
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var usernameRe = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
+
+// dummyHash is compared with passwords of unknown users,
+// so that they can not be told apart by the response time.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+type service struct {
+	storage users.Storage
+}
+
+func New(storage users.Storage) *service {
+	return &service{storage: storage}
+}
+
+func (s *service) Register(ctx context.Context, user *entities.User) (*entities.User, error) {
+	const op = "UserService.Register"
+
+	user = normalize(user)
+	if err := validation.ValidateStruct(user,
+		validation.Field(&user.Username, validation.Required, validation.Length(3, 32), validation.Match(usernameRe)),
+		validation.Field(&user.Password, validation.Required, validation.By(passwordLength)),
+		validation.Field(&user.Email, validation.Required, is.Email),
+		validation.Field(&user.FullName, validation.Length(0, 255)),
+		validation.Field(&user.Status, validation.Length(0, 255)),
+	); err != nil {
+		return nil, errors.Wrap(errs.Validation(err), op)
+	}
+
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	userID, err := id.NewULID()
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	created := *user
+	created.ID = userID
+	created.Password = hash
+	if err := s.storage.CreateUser(ctx, &created); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return withoutPassword(&created), nil
+}
+
+func (s *service) Authenticate(ctx context.Context, username, password string) (*entities.User, error) {
+	const op = "UserService.Authenticate"
+
+	user, err := s.storage.GetUserByUsername(ctx, normalizeName(username))
+	if err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+			err = users.ErrInvalidCredentials
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, errors.Wrap(users.ErrInvalidCredentials, op)
+	}
+
+	return withoutPassword(user), nil
+}
+
+// GetUser returns the full record of the current user and public profiles of others.
+func (s *service) GetUser(ctx context.Context, userID string) (*entities.User, error) {
+	const op = "UserService.GetUser"
+
+	currentID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	user, err := s.storage.GetUser(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	if user.ID != currentID {
+		return &entities.User{ID: user.ID, Username: user.Username}, nil
+	}
+	return withoutPassword(user), nil
+}
+
+// UpdateProfile updates email, full name and status of the current user.
+func (s *service) UpdateProfile(ctx context.Context, user *entities.User) (*entities.User, error) {
+	const op = "UserService.UpdateProfile"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	user = normalize(user)
+	if err := validation.ValidateStruct(user,
+		validation.Field(&user.Email, validation.Required, is.Email),
+		validation.Field(&user.FullName, validation.Length(0, 255)),
+		validation.Field(&user.Status, validation.Length(0, 255)),
+	); err != nil {
+		return nil, errors.Wrap(errs.Validation(err), op)
+	}
+
+	current, err := s.storage.GetUser(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	current.Email = user.Email
+	current.FullName = user.FullName
+	current.Status = user.Status
+
+	if err := s.storage.UpdateUser(ctx, current); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return withoutPassword(current), nil
+}
+
+func (s *service) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	const op = "UserService.ChangePassword"
+
+	userID, err := auth.RequireUser(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if err := validation.Validate(newPassword,
+		validation.Required,
+		validation.By(passwordLength),
+	); err != nil {
+		return errors.Wrap(errs.Invalid("password", err.Error()), op)
+	}
+
+	user, err := s.storage.GetUser(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)); err != nil {
+		return errors.Wrap(users.ErrInvalidCredentials, op)
+	}
+
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return errors.Wrap(s.storage.UpdatePassword(ctx, userID, hash), op)
+}
+
+// passwordLength counts bytes rather than runes, bcrypt limits the password in bytes.
+func passwordLength(value interface{}) error {
+	password, _ := value.(string)
+	if n := len(password); n < users.MinPasswordLength || n > users.MaxPasswordLength {
+		return errors.Errorf("the length must be between %d and %d bytes", users.MinPasswordLength, users.MaxPasswordLength)
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// normalize returns a copy of the user with the username and email in lower case,
+// they are unique regardless of case.
+func normalize(user *entities.User) *entities.User {
+	u := *user
+	u.Username = normalizeName(u.Username)
+	u.Email = normalizeName(u.Email)
+	return &u
+}
+
+func normalizeName(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func withoutPassword(user *entities.User) *entities.User {
+	u := *user
+	u.Password = ""
+	return &u
+}
@@ -0,0 +1,201 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alenapetraki/chat/auth"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/users"
+	"github.com/alenapetraki/chat/services/users/service"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	usersstorage "github.com/alenapetraki/chat/storage/users"
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newService(t *testing.T, driver string) users.Users {
+	db := storagetest.Connect(t, driver)
+	storagetest.Truncate(t, db)
+	return service.New(usersstorage.New(db))
+}
+
+func register(ctx context.Context, t *testing.T, svc users.Users, username string) *entities.User {
+	user, err := svc.Register(ctx, &entities.User{
+		Username: username,
+		Password: "password_" + username,
+		Email:    username + "@example.com",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func TestRegister(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc := newService(t, driver)
+			ctx := context.Background()
+
+			user := register(ctx, t, svc, "alice")
+			assert.NotEmpty(t, user.ID)
+			assert.Empty(t, user.Password, "Пароль не возвращается")
+
+			_, err := svc.Register(ctx, &entities.User{Username: "alice", Password: "password", Email: "other@example.com"})
+			assert.ErrorIs(t, err, users.ErrAlreadyExists)
+
+			_, err = svc.Register(ctx, &entities.User{Username: "Alice", Password: "password", Email: "other@example.com"})
+			assert.ErrorIs(t, err, users.ErrAlreadyExists, "Имя пользователя уникально без учета регистра")
+
+			_, err = svc.Register(ctx, &entities.User{Username: "alice2", Password: "password", Email: "Alice@Example.com"})
+			assert.ErrorIs(t, err, users.ErrAlreadyExists, "Email уникален без учета регистра")
+
+			dave, err := svc.Register(ctx, &entities.User{Username: "Dave", Password: "password", Email: " Dave@Example.com "})
+			require.NoError(t, err)
+			assert.Equal(t, "dave", dave.Username, "Имя пользователя приводится к нижнему регистру")
+			assert.Equal(t, "dave@example.com", dave.Email)
+
+			_, err = svc.Register(ctx, &entities.User{Username: "bob", Password: "short", Email: "bob@example.com"})
+			assert.ErrorIs(t, err, errs.InvalidArgument)
+			assert.Contains(t, errs.As(err).Fields, "Password")
+
+			_, err = svc.Register(ctx, &entities.User{Username: "bob", Password: "password", Email: "bob"})
+			assert.ErrorIs(t, err, errs.InvalidArgument)
+			assert.Contains(t, errs.As(err).Fields, "Email")
+
+			// 36 символов, но 72 байта
+			_, err = svc.Register(ctx, &entities.User{Username: "bob", Password: strings.Repeat("я", 36), Email: "bob@example.com"})
+			assert.NoError(t, err)
+
+			// 37 символов, но 74 байта: bcrypt не учитывает пароль дальше 72 байт
+			_, err = svc.Register(ctx, &entities.User{Username: "carol", Password: strings.Repeat("я", 37), Email: "carol@example.com"})
+			assert.ErrorIs(t, err, errs.InvalidArgument, "Длина пароля считается в байтах")
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc := newService(t, driver)
+			ctx := context.Background()
+
+			user := register(ctx, t, svc, "alice")
+
+			res, err := svc.Authenticate(ctx, "alice", "password_alice")
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, res.ID)
+			assert.Empty(t, res.Password, "Пароль не возвращается")
+
+			res, err = svc.Authenticate(ctx, " ALICE ", "password_alice")
+			require.NoError(t, err, "Имя пользователя при входе не зависит от регистра")
+			assert.Equal(t, user.ID, res.ID)
+
+			_, err = svc.Authenticate(ctx, "alice", "wrong_password")
+			assert.ErrorIs(t, err, users.ErrInvalidCredentials)
+
+			_, err = svc.Authenticate(ctx, "unknown", "password_alice")
+			assert.ErrorIs(t, err, users.ErrInvalidCredentials, "Неизвестный пользователь неотличим от неверного пароля")
+		})
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc := newService(t, driver)
+			user := register(context.Background(), t, svc, "alice")
+			ctx := auth.WithUser(context.Background(), user.ID)
+
+			_, err := svc.UpdateProfile(context.Background(), &entities.User{Email: "new@example.com"})
+			assert.ErrorIs(t, err, errs.Unauthenticated)
+
+			_, err = svc.UpdateProfile(ctx, &entities.User{Email: "new"})
+			assert.ErrorIs(t, err, errs.InvalidArgument)
+
+			res, err := svc.UpdateProfile(ctx, &entities.User{
+				Username: "mallory",
+				Email:    "new@example.com",
+				FullName: "Alice",
+				Status:   "busy",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "alice", res.Username, "Имя пользователя не меняется")
+			assert.Equal(t, "new@example.com", res.Email)
+			assert.Equal(t, "Alice", res.FullName)
+			assert.Equal(t, "busy", res.Status)
+			assert.Empty(t, res.Password)
+
+			res, err = svc.GetUser(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "new@example.com", res.Email)
+
+			res, err = svc.UpdateProfile(ctx, &entities.User{Email: "New@Example.com"})
+			require.NoError(t, err)
+			assert.Equal(t, "new@example.com", res.Email, "Email приводится к нижнему регистру")
+
+			_, err = svc.Authenticate(ctx, "alice", "password_alice")
+			assert.NoError(t, err, "Пароль не меняется")
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc := newService(t, driver)
+			alice := register(context.Background(), t, svc, "alice")
+			bob := register(context.Background(), t, svc, "bob")
+			ctx := auth.WithUser(context.Background(), alice.ID)
+
+			_, err := svc.GetUser(context.Background(), alice.ID)
+			assert.ErrorIs(t, err, errs.Unauthenticated)
+
+			res, err := svc.GetUser(ctx, alice.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "alice@example.com", res.Email, "Свой профиль возвращается полностью")
+			assert.Empty(t, res.Password)
+
+			res, err = svc.GetUser(ctx, bob.ID)
+			require.NoError(t, err)
+			assert.Equal(t, &entities.User{ID: bob.ID, Username: "bob"}, res, "Чужой профиль возвращается без личных данных")
+
+			_, err = svc.GetUser(ctx, "unknown")
+			assert.ErrorIs(t, err, users.ErrNotFound)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+
+			svc := newService(t, driver)
+			user := register(context.Background(), t, svc, "alice")
+			ctx := auth.WithUser(context.Background(), user.ID)
+
+			err := svc.ChangePassword(context.Background(), "password_alice", "new_password")
+			assert.ErrorIs(t, err, errs.Unauthenticated)
+
+			err = svc.ChangePassword(ctx, "wrong_password", "new_password")
+			assert.ErrorIs(t, err, users.ErrInvalidCredentials)
+
+			err = svc.ChangePassword(ctx, "password_alice", "short")
+			assert.ErrorIs(t, err, errs.InvalidArgument)
+			assert.Contains(t, errs.As(err).Fields, "password")
+
+			require.NoError(t, svc.ChangePassword(ctx, "password_alice", "new_password"))
+
+			_, err = svc.Authenticate(ctx, "alice", "password_alice")
+			assert.ErrorIs(t, err, users.ErrInvalidCredentials, "Старый пароль больше не подходит")
+
+			_, err = svc.Authenticate(ctx, "alice", "new_password")
+			assert.NoError(t, err)
+		})
+	}
+}
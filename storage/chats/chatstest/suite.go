@@ -0,0 +1,857 @@
+// Package chatstest contains a conformance test suite for chats.Storage implementations.
+package chatstest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/id"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+// Run runs the suite against storages returned by newStorage,
+// which is called before each test and must return an empty storage.
+func Run(t *testing.T, newStorage func() chats.Storage) {
+	suite.Run(t, &testSuite{newStorage: newStorage})
+}
+
+type testSuite struct {
+	suite.Suite
+	newStorage func() chats.Storage
+	st         chats.Storage
+}
+
+func (t *testSuite) SetupTest() {
+	t.st = t.newStorage()
+}
+
+func (t *testSuite) createChat(typ entities.ChatType, name string) *entities.Chat {
+	chat := &entities.Chat{
+		ID:          id.MustNewULID(),
+		Type:        typ,
+		Name:        name,
+		Description: "just a " + string(typ),
+		AvatarURL:   "https://test.some",
+	}
+	t.Require().NoError(t.st.CreateChat(context.Background(), chat))
+	return chat
+}
+
+func (t *testSuite) setMember(ctx context.Context, chatID, userID string, role entities.Role) {
+	_, err := t.st.SetMember(ctx, chatID, userID, role)
+	t.Require().NoError(err)
+}
+
+func (t *testSuite) TestCreateChat() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+
+	res, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(chat, res)
+
+	t.Assert().Error(t.st.CreateChat(ctx, chat), "id must be unique")
+}
+
+func (t *testSuite) TestGetChat_NotFound() {
+
+	chat, err := t.st.GetChat(context.Background(), "not_exist")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	t.Assert().Nil(chat)
+}
+
+func (t *testSuite) TestUpdateChat() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	t.Require().NoError(t.st.UpdateChat(ctx, &entities.Chat{
+		ID:          chat.ID,
+		Type:        entities.ChannelType,
+		Name:        "new name",
+		Description: "new description",
+	}))
+
+	res, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(entities.GroupType, res.Type, "type cannot be changed")
+	t.Assert().Equal("new name", res.Name)
+	t.Assert().Equal("new description", res.Description)
+	t.Assert().Equal("", res.AvatarURL)
+
+	err = t.st.UpdateChat(ctx, &entities.Chat{ID: "not_exist", Name: "name"})
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+}
+
+func (t *testSuite) TestDeleteChat_Force() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	t.setMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+	t.Assert().ErrorIs(t.st.DeleteChat(ctx, chat.ID, true), chats.ErrNotFound, "Окончательно удаляются только удаленные чаты")
+	_, err := t.st.GetRole(ctx, chat.ID, "user_1")
+	t.Require().NoError(err)
+
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID))
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID, true))
+
+	_, err = t.st.GetDeletedChat(ctx, chat.ID)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+
+	t.Assert().ErrorIs(t.st.DeleteChat(ctx, chat.ID, true), chats.ErrNotFound)
+}
+
+func (t *testSuite) TestDeleteChat_Restore() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	t.setMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+	t.setMember(ctx, chat.ID, "user_2", entities.RoleMember)
+	alive := t.createChat(entities.GroupType, "group two")
+
+	before := time.Now().UTC().Add(-time.Second)
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID))
+	t.Assert().ErrorIs(t.st.DeleteChat(ctx, chat.ID), chats.ErrNotFound, "Чат уже удален")
+
+	_, err := t.st.GetChat(ctx, chat.ID)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	_, err = t.st.GetDeletedChat(ctx, alive.ID)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+
+	deleted, err := t.st.GetDeletedChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Require().NotNil(deleted.DeletedAt)
+	t.Assert().WithinDuration(time.Now(), *deleted.DeletedAt, time.Minute)
+	t.Assert().Equal("group one", deleted.Name)
+
+	role, err := t.st.GetRole(ctx, chat.ID, "user_2")
+	t.Require().NoError(err)
+	t.Assert().Equal(entities.RoleMember, role, "Участники удаленного чата сохраняются")
+
+	ids, err := t.st.FindDeletedChatIDs(ctx, before, 10)
+	t.Require().NoError(err)
+	t.Assert().Empty(ids)
+	ids, err = t.st.FindDeletedChatIDs(ctx, time.Now().UTC().Add(time.Second), 10)
+	t.Require().NoError(err)
+	t.Assert().Equal([]string{chat.ID}, ids)
+
+	t.Require().NoError(t.st.RestoreChat(ctx, chat.ID))
+	t.Assert().ErrorIs(t.st.RestoreChat(ctx, chat.ID), chats.ErrNotFound)
+	t.Assert().ErrorIs(t.st.RestoreChat(ctx, alive.ID), chats.ErrNotFound)
+
+	got, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(2, got.NumMembers)
+
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID))
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID, true), "Удаленный чат удаляется окончательно")
+	_, err = t.st.GetDeletedChat(ctx, chat.ID)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	_, err = t.st.GetRole(ctx, chat.ID, "user_1")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+}
+
+func (t *testSuite) TestDeleteMemberOfDeletedChats() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	t.setMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+	t.setMember(ctx, chat.ID, "user_2", entities.RoleMember)
+	alive := t.createChat(entities.GroupType, "group two")
+	t.setMember(ctx, alive.ID, "user_2", entities.RoleMember)
+
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID))
+
+	ids, err := t.st.FindMemberChatIDs(ctx, "user_2")
+	t.Require().NoError(err)
+	t.Assert().Equal([]string{alive.ID}, ids, "Удаленные чаты не возвращаются")
+
+	n, err := t.st.DeleteMemberOfDeletedChats(ctx, "user_2")
+	t.Require().NoError(err)
+	t.Assert().Equal(1, n)
+
+	t.Require().NoError(t.st.RestoreChat(ctx, chat.ID))
+	_, err = t.st.GetRole(ctx, chat.ID, "user_2")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	got, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, got.NumMembers)
+
+	_, err = t.st.GetRole(ctx, alive.ID, "user_2")
+	t.Assert().NoError(err, "Участие в остальных чатах сохраняется")
+}
+
+func (t *testSuite) TestRestoreChat_Dialog() {
+
+	ctx := context.Background()
+
+	dialog := t.createChat(entities.DialogType, "")
+	t.setMember(ctx, dialog.ID, "user_1", entities.RoleOwner)
+	t.setMember(ctx, dialog.ID, "user_2", entities.RoleOwner)
+	t.Require().NoError(t.st.SetDialogUsers(ctx, dialog.ID, "user_1", "user_2"))
+	t.Require().NoError(t.st.DeleteChat(ctx, dialog.ID))
+
+	other := t.createChat(entities.DialogType, "")
+	t.setMember(ctx, other.ID, "user_1", entities.RoleOwner)
+	t.setMember(ctx, other.ID, "user_2", entities.RoleOwner)
+	t.Require().NoError(t.st.SetDialogUsers(ctx, other.ID, "user_2", "user_1"))
+
+	t.Assert().ErrorIs(t.st.RestoreChat(ctx, dialog.ID), chats.ErrDialogExists, "У собеседников уже есть диалог")
+
+	t.Require().NoError(t.st.DeleteChat(ctx, other.ID))
+	t.Require().NoError(t.st.DeleteChat(ctx, other.ID, true))
+	t.Require().NoError(t.st.RestoreChat(ctx, dialog.ID))
+
+	got, err := t.st.GetDialog(ctx, "user_1", "user_2")
+	t.Require().NoError(err)
+	t.Assert().Equal(dialog.ID, got.ID)
+}
+
+func (t *testSuite) TestMembers() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	other := t.createChat(entities.GroupType, "group two")
+
+	t.setMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+	for i := 2; i <= 5; i++ {
+		t.setMember(ctx, chat.ID, "user_"+strconv.Itoa(i), entities.RoleMember)
+	}
+	t.setMember(ctx, other.ID, "user_2", entities.RoleOwner)
+
+	res, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(5, res.NumMembers)
+
+	role, err := t.st.GetRole(ctx, chat.ID, "user_1")
+	t.Require().NoError(err)
+	t.Assert().Equal(entities.RoleOwner, role)
+
+	_, err = t.st.GetRole(ctx, chat.ID, "user_42")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+
+	ids, err := t.st.FindMemberChatIDs(ctx, "user_2")
+	t.Require().NoError(err)
+	t.Assert().ElementsMatch([]string{chat.ID, other.ID}, ids)
+
+	_, err = t.st.SetMember(ctx, "not_exist", "user_1", entities.RoleOwner)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+}
+
+func (t *testSuite) TestChatPolicy() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+
+	policy, err := t.st.GetChatPolicy(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Nil(policy)
+
+	premium := &chats.ChatPolicy{
+		MaxMembers: 10000,
+		AddMembers: []entities.Role{entities.RoleOwner},
+		EditChat:   []entities.Role{entities.RoleOwner, entities.RoleMember},
+		CanLeave:   true,
+	}
+	t.Require().NoError(t.st.SetChatPolicy(ctx, chat.ID, premium))
+
+	policy, err = t.st.GetChatPolicy(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(premium, policy)
+
+	t.Require().NoError(t.st.SetChatPolicy(ctx, chat.ID, nil))
+	policy, err = t.st.GetChatPolicy(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Nil(policy)
+
+	err = t.st.SetChatPolicy(ctx, "unknown", premium)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	_, err = t.st.GetChatPolicy(ctx, "unknown")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+}
+
+func (t *testSuite) TestChatPolicy_ResetKeepsState() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	editor := &entities.ChatRole{Name: "editor", Rank: 50, Permissions: entities.PermPost | entities.PermEditChat}
+	t.Require().NoError(t.st.SetChatRole(ctx, chat.ID, editor))
+	change := &entities.OwnershipChange{
+		ChatID:     chat.ID,
+		FromUserID: "owner",
+		ToUserID:   "admin",
+		Reason:     entities.OwnershipTransferred,
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	t.Require().NoError(t.st.AddOwnershipChange(ctx, change))
+
+	t.Require().NoError(t.st.SetChatPolicy(ctx, chat.ID, &chats.ChatPolicy{MaxMembers: 10000, DefaultRole: entities.RoleMember}))
+	t.Require().NoError(t.st.SetChatPolicy(ctx, chat.ID, nil))
+
+	roles, err := t.st.FindChatRoles(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal([]*entities.ChatRole{editor}, roles, "Сброс политики не удаляет роли чата")
+
+	changes, err := t.st.FindOwnershipChanges(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Len(changes, 1, "Сброс политики не удаляет историю владения")
+}
+
+func (t *testSuite) TestChatRoles() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+
+	roles, err := t.st.FindChatRoles(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Len(roles, 0)
+
+	editor := &entities.ChatRole{Name: "editor", Rank: 50, Permissions: entities.PermPost | entities.PermEditChat}
+	helper := &entities.ChatRole{Name: "helper", Rank: 30, Permissions: entities.PermPin}
+	t.Require().NoError(t.st.SetChatRole(ctx, chat.ID, helper))
+	t.Require().NoError(t.st.SetChatRole(ctx, chat.ID, editor))
+
+	role, err := t.st.GetChatRole(ctx, chat.ID, "editor")
+	t.Require().NoError(err)
+	t.Assert().Equal(editor, role)
+
+	helper.Rank = 70
+	t.Require().NoError(t.st.SetChatRole(ctx, chat.ID, helper))
+
+	roles, err = t.st.FindChatRoles(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal([]*entities.ChatRole{helper, editor}, roles)
+
+	t.Require().NoError(t.st.DeleteChatRole(ctx, chat.ID, "helper"))
+	_, err = t.st.GetChatRole(ctx, chat.ID, "helper")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	t.Assert().ErrorIs(t.st.DeleteChatRole(ctx, chat.ID, "helper"), chats.ErrNotFound)
+
+	other := t.createChat(entities.GroupType, "group two")
+	_, err = t.st.GetChatRole(ctx, other.ID, "editor")
+	t.Assert().ErrorIs(err, chats.ErrNotFound, "Роли принадлежат чату")
+}
+
+func (t *testSuite) TestOwnership() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	t.setMember(ctx, chat.ID, "owner", entities.RoleOwner)
+	t.setMember(ctx, chat.ID, "zed", entities.RoleAdmin)
+	t.setMember(ctx, chat.ID, "amy", entities.RoleAdmin)
+
+	admin, err := t.st.GetOldestMember(ctx, chat.ID, entities.RoleAdmin)
+	t.Require().NoError(err)
+	t.Assert().Equal(&entities.ChatMember{UserID: "zed", Role: entities.RoleAdmin}, admin, "Самый давний, а не первый по алфавиту")
+
+	_, err = t.st.GetOldestMember(ctx, chat.ID, entities.RoleModerator)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	changes := []*entities.OwnershipChange{
+		{ChatID: chat.ID, FromUserID: "owner", ToUserID: "zed", Reason: entities.OwnershipTransferred, CreatedAt: now},
+		{ChatID: chat.ID, FromUserID: "zed", Reason: entities.OwnershipLeft, CreatedAt: now.Add(time.Second)},
+	}
+	for _, c := range changes {
+		t.Require().NoError(t.st.AddOwnershipChange(ctx, c))
+	}
+
+	stored, err := t.st.FindOwnershipChanges(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Require().Len(stored, len(changes))
+	for i, c := range stored {
+		t.Assert().True(changes[i].CreatedAt.Equal(c.CreatedAt))
+		c.CreatedAt = changes[i].CreatedAt
+	}
+	t.Assert().Equal(changes, stored)
+
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID))
+	t.Require().NoError(t.st.DeleteChat(ctx, chat.ID, true))
+	stored, err = t.st.FindOwnershipChanges(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Len(stored, 0)
+}
+
+func (t *testSuite) TestDialogs() {
+
+	ctx := context.Background()
+
+	dialog := t.createChat(entities.DialogType, "")
+	t.Require().NoError(t.st.SetDialogUsers(ctx, dialog.ID, "user_2", "user_1"))
+
+	for _, users := range [][2]string{{"user_1", "user_2"}, {"user_2", "user_1"}} {
+		got, err := t.st.GetDialog(ctx, users[0], users[1])
+		t.Require().NoError(err)
+		t.Assert().Equal(dialog.ID, got.ID)
+		t.Assert().Equal(entities.DialogType, got.Type)
+	}
+	_, err := t.st.GetDialog(ctx, "user_1", "user_3")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+
+	other := t.createChat(entities.DialogType, "")
+	t.Assert().ErrorIs(t.st.SetDialogUsers(ctx, other.ID, "user_1", "user_2"), chats.ErrDialogExists)
+	t.Require().NoError(t.st.SetDialogUsers(ctx, other.ID, "user_1", "user_3"))
+
+	t.Require().NoError(t.st.DeleteChat(ctx, dialog.ID))
+	t.Require().NoError(t.st.DeleteChat(ctx, dialog.ID, true))
+	_, err = t.st.GetDialog(ctx, "user_1", "user_2")
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+	t.Require().NoError(t.st.SetDialogUsers(ctx, other.ID, "user_1", "user_2"), "Удаленный диалог не мешает")
+}
+
+func (t *testSuite) TestAddSubscriber() {
+
+	ctx := context.Background()
+
+	channel := t.createChat(entities.ChannelType, "channel")
+	group := t.createChat(entities.GroupType, "group")
+	t.setMember(ctx, channel.ID, "owner", entities.RoleOwner)
+	t.setMember(ctx, group.ID, "owner", entities.RoleOwner)
+
+	for i := 0; i < 40; i++ {
+		added, err := t.st.AddSubscriber(ctx, channel.ID, "user_"+strconv.Itoa(i), entities.RoleSubscriber)
+		t.Require().NoError(err)
+		t.Assert().True(added)
+	}
+	added, err := t.st.AddSubscriber(ctx, channel.ID, "owner", entities.RoleSubscriber)
+	t.Require().NoError(err)
+	t.Assert().False(added, "Уже участник")
+
+	role, err := t.st.GetRole(ctx, channel.ID, "owner")
+	t.Require().NoError(err)
+	t.Assert().Equal(entities.RoleOwner, role, "Роль не меняется")
+
+	got, err := t.st.GetChat(ctx, channel.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(41, got.NumMembers)
+
+	_, err = t.st.DeleteMembers(ctx, channel.ID, "user_0", "user_1")
+	t.Require().NoError(err)
+	got, err = t.st.GetChat(ctx, channel.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(39, got.NumMembers)
+
+	res, _, err := t.st.FindChats(ctx, nil, nil, &util.SortOptions{Sort: []util.SortField{{Name: "num_members", Descending: true}}})
+	t.Require().NoError(err)
+	t.Require().Len(res, 2)
+	t.Assert().Equal(channel.ID, res[0].ID)
+	t.Assert().Equal(39, res[0].NumMembers)
+
+	_, err = t.st.AddSubscriber(ctx, "unknown", "user_1", entities.RoleSubscriber)
+	t.Assert().Error(err)
+}
+
+func (t *testSuite) TestSetMember_ChangeRole() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+
+	added, err := t.st.SetMember(ctx, chat.ID, "user_1", entities.RoleMember)
+	t.Require().NoError(err)
+	t.Assert().True(added)
+
+	for _, role := range []entities.Role{entities.RoleAdmin, entities.RoleOwner, entities.RoleOwner} {
+		added, err = t.st.SetMember(ctx, chat.ID, "user_1", role)
+		t.Require().NoError(err)
+		t.Assert().False(added, "Участник уже добавлен")
+	}
+
+	role, err := t.st.GetRole(ctx, chat.ID, "user_1")
+	t.Require().NoError(err)
+	t.Assert().Equal(entities.RoleOwner, role)
+
+	ms, _, err := t.st.FindChatMembers(ctx, chat.ID, nil, nil)
+	t.Require().NoError(err)
+	t.Require().Len(ms, 1)
+	t.Assert().Equal("user_1", ms[0].UserID)
+
+	got, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, got.NumMembers, "Смена роли не меняет число участников")
+}
+
+func (t *testSuite) TestReconcileMemberCounts() {
+
+	ctx := context.Background()
+
+	group := t.createChat(entities.GroupType, "group")
+	channel := t.createChat(entities.ChannelType, "channel")
+	t.setMember(ctx, group.ID, "owner", entities.RoleOwner)
+	t.setMember(ctx, group.ID, "user_1", entities.RoleMember)
+	t.setMember(ctx, group.ID, "user_1", entities.RoleAdmin)
+	t.setMember(ctx, channel.ID, "owner", entities.RoleOwner)
+	for i := 0; i < 5; i++ {
+		_, err := t.st.AddSubscriber(ctx, channel.ID, "user_"+strconv.Itoa(i), entities.RoleSubscriber)
+		t.Require().NoError(err)
+	}
+	_, err := t.st.DeleteMembers(ctx, channel.ID, "user_0")
+	t.Require().NoError(err)
+
+	n, err := t.st.ReconcileMemberCounts(ctx)
+	t.Require().NoError(err)
+	t.Assert().Equal(0, n, "Счетчики не должны расходиться с участниками")
+
+	for chatID, num := range map[string]int{group.ID: 2, channel.ID: 5} {
+		got, err := t.st.GetChat(ctx, chatID)
+		t.Require().NoError(err)
+		t.Assert().Equal(num, got.NumMembers)
+	}
+}
+
+func (t *testSuite) TestFindChatMembers() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	t.setMember(ctx, chat.ID, "user_3", entities.RoleMember)
+	t.setMember(ctx, chat.ID, "user_2", entities.RoleOwner)
+	t.setMember(ctx, chat.ID, "user_1", entities.RoleMember)
+
+	t.setMember(ctx, chat.ID, "user_4", entities.RoleOwner)
+
+	ms, _, err := t.st.FindChatMembers(ctx, chat.ID, nil, nil)
+	t.Require().NoError(err)
+	t.Assert().Equal([]*entities.ChatMember{
+		{UserID: "user_1", Role: entities.RoleMember},
+		{UserID: "user_2", Role: entities.RoleOwner},
+		{UserID: "user_3", Role: entities.RoleMember},
+		{UserID: "user_4", Role: entities.RoleOwner},
+	}, ms)
+
+	ms, _, err = t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2, Offset: 1})
+	t.Require().NoError(err)
+	t.Require().Len(ms, 2)
+	t.Assert().Equal("user_2", ms[0].UserID)
+	t.Assert().Equal("user_3", ms[1].UserID)
+
+	ms, _, err = t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2, Offset: 5})
+	t.Require().NoError(err)
+	t.Assert().Len(ms, 0)
+
+	ms, _, err = t.st.FindChatMembers(ctx, chat.ID, &chats.FindChatMembersFilter{
+		Roles: []entities.Role{entities.RoleOwner},
+	}, nil)
+	t.Require().NoError(err)
+	t.Assert().Equal([]*entities.ChatMember{
+		{UserID: "user_2", Role: entities.RoleOwner},
+		{UserID: "user_4", Role: entities.RoleOwner},
+	}, ms)
+}
+
+func (t *testSuite) TestFindChatMembers_Cursor() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	for i := 1; i <= 5; i++ {
+		t.setMember(ctx, chat.ID, "user_"+strconv.Itoa(i), entities.RoleMember)
+	}
+
+	userIDs := func(ms []*entities.ChatMember) []string {
+		res := make([]string, len(ms))
+		for i, m := range ms {
+			res[i] = m.UserID
+		}
+		return res
+	}
+
+	ms, page, err := t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2})
+	t.Require().NoError(err)
+	t.Assert().Equal([]string{"user_1", "user_2"}, userIDs(ms))
+	t.Assert().Empty(page.PrevCursor)
+	t.Require().NotEmpty(page.NextCursor)
+
+	ms, page, err = t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2, Cursor: page.NextCursor})
+	t.Require().NoError(err)
+	t.Assert().Equal([]string{"user_3", "user_4"}, userIDs(ms))
+	t.Require().NotEmpty(page.PrevCursor)
+	t.Require().NotEmpty(page.NextCursor)
+	prev := page.PrevCursor
+
+	// новые участники до курсора не сдвигают следующую страницу
+	t.setMember(ctx, chat.ID, "user_0", entities.RoleMember)
+
+	ms, page, err = t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2, Cursor: page.NextCursor})
+	t.Require().NoError(err)
+	t.Assert().Equal([]string{"user_5"}, userIDs(ms))
+	t.Assert().Empty(page.NextCursor)
+	t.Assert().NotEmpty(page.PrevCursor)
+
+	ms, page, err = t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2, Cursor: prev})
+	t.Require().NoError(err)
+	t.Assert().Equal([]string{"user_1", "user_2"}, userIDs(ms))
+	t.Assert().NotEmpty(page.PrevCursor, "user_0 is before the page")
+	t.Assert().NotEmpty(page.NextCursor)
+
+	_, _, err = t.st.FindChatMembers(ctx, chat.ID, nil, &util.PaginationOptions{Limit: 2, Cursor: "garbage"})
+	t.Assert().ErrorIs(err, util.ErrInvalidCursor)
+
+	other := t.createChat(entities.GroupType, "group two")
+	_, _, err = t.st.FindChatMembers(ctx, other.ID, nil, &util.PaginationOptions{Limit: 2, Cursor: prev})
+	t.Assert().ErrorIs(err, util.ErrInvalidCursor, "Курсор другого чата")
+
+	filter := &chats.FindChatMembersFilter{Roles: []entities.Role{entities.RoleOwner}}
+	_, _, err = t.st.FindChatMembers(ctx, chat.ID, filter, &util.PaginationOptions{Limit: 2, Cursor: prev})
+	t.Assert().ErrorIs(err, util.ErrInvalidCursor, "Курсор списка с другим фильтром")
+}
+
+func (t *testSuite) TestDeleteMembers() {
+
+	ctx := context.Background()
+
+	chat := t.createChat(entities.GroupType, "group one")
+	for i := 1; i <= 4; i++ {
+		t.setMember(ctx, chat.ID, "user_"+strconv.Itoa(i), entities.RoleMember)
+	}
+
+	n, err := t.st.DeleteMembers(ctx, chat.ID, "user_1", "user_2", "user_42")
+	t.Require().NoError(err)
+	t.Assert().Equal(2, n)
+
+	res, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(2, res.NumMembers)
+
+	n, err = t.st.DeleteMembers(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(2, n)
+
+	res, err = t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(0, res.NumMembers)
+
+	ms, _, err := t.st.FindChatMembers(ctx, chat.ID, nil, nil)
+	t.Require().NoError(err)
+	t.Assert().Len(ms, 0)
+}
+
+func (t *testSuite) TestRunTx_Commit() {
+
+	ctx := context.Background()
+
+	chat := &entities.Chat{ID: id.MustNewULID(), Type: entities.GroupType, Name: "group"}
+	err := t.st.RunTx(ctx, nil, func(st chats.Storage) error {
+		if err := st.CreateChat(ctx, chat); err != nil {
+			return err
+		}
+		_, err := st.SetMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+		return err
+	})
+	t.Require().NoError(err)
+
+	res, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, res.NumMembers)
+}
+
+func (t *testSuite) TestRunTx_Rollback() {
+
+	ctx := context.Background()
+
+	existing := t.createChat(entities.GroupType, "group one")
+	t.setMember(ctx, existing.ID, "user_1", entities.RoleOwner)
+
+	chat := &entities.Chat{ID: id.MustNewULID(), Type: entities.GroupType, Name: "group"}
+	errFailed := errors.New("failed")
+
+	err := t.st.RunTx(ctx, nil, func(st chats.Storage) error {
+		if err := st.CreateChat(ctx, chat); err != nil {
+			return err
+		}
+		if _, err := st.SetMember(ctx, existing.ID, "user_2", entities.RoleMember); err != nil {
+			return err
+		}
+		if _, err := st.DeleteMembers(ctx, existing.ID, "user_1"); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	t.Require().ErrorIs(err, errFailed)
+
+	_, err = t.st.GetChat(ctx, chat.ID)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+
+	res, err := t.st.GetChat(ctx, existing.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, res.NumMembers)
+
+	ms, _, err := t.st.FindChatMembers(ctx, existing.ID, nil, nil)
+	t.Require().NoError(err)
+	t.Assert().Equal([]*entities.ChatMember{{UserID: "user_1", Role: entities.RoleOwner}}, ms)
+}
+
+func (t *testSuite) TestRunTx_Nested() {
+
+	ctx := context.Background()
+
+	chat := &entities.Chat{ID: id.MustNewULID(), Type: entities.GroupType, Name: "group"}
+	errFailed := errors.New("failed")
+
+	err := t.st.RunTx(ctx, nil, func(st chats.Storage) error {
+		if err := st.CreateChat(ctx, chat); err != nil {
+			return err
+		}
+		if err := st.RunTx(ctx, nil, func(st chats.Storage) error {
+			_, err := st.SetMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+			return err
+		}); err != nil {
+			return err
+		}
+
+		err := st.RunTx(ctx, nil, func(st chats.Storage) error {
+			if _, err := st.SetMember(ctx, chat.ID, "user_2", entities.RoleMember); err != nil {
+				return err
+			}
+			return errFailed
+		})
+		t.Require().ErrorIs(err, errFailed)
+		return nil
+	})
+	t.Require().NoError(err)
+
+	res, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, res.NumMembers, "Откатывается только вложенная транзакция")
+
+	ms, _, err := t.st.FindChatMembers(ctx, chat.ID, nil, nil)
+	t.Require().NoError(err)
+	t.Assert().Equal([]*entities.ChatMember{{UserID: "user_1", Role: entities.RoleOwner}}, ms)
+}
+
+func (t *testSuite) TestRunTx_Panic() {
+
+	ctx := context.Background()
+
+	chat := &entities.Chat{ID: id.MustNewULID(), Type: entities.GroupType, Name: "group"}
+
+	t.Assert().Panics(func() {
+		_ = t.st.RunTx(ctx, nil, func(st chats.Storage) error {
+			if err := st.CreateChat(ctx, chat); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	})
+
+	_, err := t.st.GetChat(ctx, chat.ID)
+	t.Assert().ErrorIs(err, chats.ErrNotFound)
+}
+
+func (t *testSuite) TestFindChats() {
+
+	ctx := context.Background()
+
+	group1 := t.createChat(entities.GroupType, "Cats & dogs")
+	group2 := t.createChat(entities.GroupType, "100% cats")
+	channel := t.createChat(entities.ChannelType, "cat news")
+	dialog := t.createChat(entities.DialogType, "")
+	foreign := t.createChat(entities.GroupType, "cats of other people")
+
+	for _, chat := range []*entities.Chat{group1, group2, channel, dialog} {
+		t.setMember(ctx, chat.ID, "user_1", entities.RoleOwner)
+	}
+	t.setMember(ctx, group2.ID, "user_2", entities.RoleMember)
+	t.setMember(ctx, foreign.ID, "user_2", entities.RoleOwner)
+
+	ids := func(chats []*entities.Chat) []string {
+		res := make([]string, len(chats))
+		for i, c := range chats {
+			res[i] = c.ID
+		}
+		return res
+	}
+
+	t.Run("member", func() {
+		res, page, err := t.st.FindChats(ctx, &chats.FindChatsFilter{MemberID: "user_1"}, nil, nil)
+		t.Require().NoError(err)
+		t.Assert().Equal(4, page.Total)
+		t.Assert().Equal([]string{group1.ID, group2.ID, channel.ID, dialog.ID}, ids(res))
+		t.Assert().Equal(group2.Name, res[1].Name)
+		t.Assert().Equal(2, res[1].NumMembers)
+	})
+
+	t.Run("types", func() {
+		res, page, err := t.st.FindChats(ctx, &chats.FindChatsFilter{
+			MemberID: "user_1",
+			Types:    []entities.ChatType{entities.ChannelType, entities.DialogType},
+		}, nil, nil)
+		t.Require().NoError(err)
+		t.Assert().Equal(2, page.Total)
+		t.Assert().Equal([]string{channel.ID, dialog.ID}, ids(res))
+	})
+
+	t.Run("name", func() {
+		res, _, err := t.st.FindChats(ctx, &chats.FindChatsFilter{MemberID: "user_1", Name: "CAT"}, nil, nil)
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{group1.ID, group2.ID, channel.ID}, ids(res))
+
+		res, _, err = t.st.FindChats(ctx, &chats.FindChatsFilter{Name: "0% c"}, nil, nil)
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{group2.ID}, ids(res), "wildcards must be escaped")
+	})
+
+	t.Run("pagination and sort", func() {
+		res, page, err := t.st.FindChats(ctx,
+			&chats.FindChatsFilter{MemberID: "user_1", Types: []entities.ChatType{entities.GroupType, entities.ChannelType}},
+			&util.PaginationOptions{Limit: 2, Offset: 1},
+			&util.SortOptions{Sort: []util.SortField{{Name: "type"}, {Name: "name"}}},
+		)
+		t.Require().NoError(err)
+		t.Assert().Equal(3, page.Total)
+		t.Assert().Equal([]string{group2.ID, group1.ID}, ids(res))
+
+		res, _, err = t.st.FindChats(ctx, nil, nil, &util.SortOptions{Sort: []util.SortField{{Name: "num_members"}}})
+		t.Require().NoError(err)
+		t.Assert().Equal(group2.ID, res[len(res)-1].ID)
+
+		sort, err := chats.ParseSort("-type,-created_at")
+		t.Require().NoError(err)
+		res, _, err = t.st.FindChats(ctx, &chats.FindChatsFilter{MemberID: "user_1"}, nil, sort)
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{group2.ID, group1.ID, dialog.ID, channel.ID}, ids(res))
+
+		_, _, err = t.st.FindChats(ctx, nil, nil, &util.SortOptions{Sort: []util.SortField{{Name: "name; drop table chat"}}})
+		var sortErr *util.SortFieldError
+		t.Assert().ErrorAs(err, &sortErr)
+		t.Assert().ErrorIs(err, util.ErrInvalidSort)
+	})
+
+	t.Run("cursor", func() {
+		filter := &chats.FindChatsFilter{MemberID: "user_1"}
+
+		res, page, err := t.st.FindChats(ctx, filter, &util.PaginationOptions{Limit: 3}, nil)
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{group1.ID, group2.ID, channel.ID}, ids(res))
+		t.Assert().Equal(4, page.Total)
+		t.Require().NotEmpty(page.NextCursor)
+
+		res, page, err = t.st.FindChats(ctx, filter, &util.PaginationOptions{Limit: 3, Cursor: page.NextCursor}, nil)
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{dialog.ID}, ids(res))
+		t.Assert().Empty(page.NextCursor)
+
+		_, _, err = t.st.FindChats(ctx, &chats.FindChatsFilter{MemberID: "user_2"}, &util.PaginationOptions{Limit: 3, Cursor: page.PrevCursor}, nil)
+		t.Assert().ErrorIs(err, util.ErrInvalidCursor, "Курсор списка с другим фильтром")
+
+		_, _, err = t.st.FindChats(ctx, filter, &util.PaginationOptions{Limit: 3, Cursor: page.PrevCursor},
+			&util.SortOptions{Sort: []util.SortField{{Name: "name"}}})
+		t.Assert().ErrorIs(err, chats.ErrCursorWithSort)
+	})
+}
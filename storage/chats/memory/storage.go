@@ -0,0 +1,745 @@
+// Package memory implements chats.Storage in memory, mainly for tests.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/util"
+	"github.com/pkg/errors"
+)
+
+type state struct {
+	chats    map[string]*entities.Chat
+	members  map[string]map[string]entities.Role // chat id -> user id -> role
+	policies map[string]*chats.ChatPolicy        // stored policies are never modified
+	roles    map[string]map[entities.Role]entities.ChatRole
+	// joined orders members by the time they joined
+	joined     map[string]map[string]int64
+	joinSeq    int64
+	ownerships map[string][]entities.OwnershipChange
+	dialogs    map[[2]string]string // ordered user ids -> chat id
+}
+
+func (st *state) clone() *state {
+	c := &state{
+		chats:    make(map[string]*entities.Chat, len(st.chats)),
+		members:  make(map[string]map[string]entities.Role, len(st.members)),
+		policies: make(map[string]*chats.ChatPolicy, len(st.policies)),
+		roles:    make(map[string]map[entities.Role]entities.ChatRole, len(st.roles)),
+
+		joined:     make(map[string]map[string]int64, len(st.joined)),
+		joinSeq:    st.joinSeq,
+		ownerships: make(map[string][]entities.OwnershipChange, len(st.ownerships)),
+		dialogs:    make(map[[2]string]string, len(st.dialogs)),
+	}
+	for users, chatID := range st.dialogs {
+		c.dialogs[users] = chatID
+	}
+	for chatID, js := range st.joined {
+		c.joined[chatID] = make(map[string]int64, len(js))
+		for userID, seq := range js {
+			c.joined[chatID][userID] = seq
+		}
+	}
+	for chatID, changes := range st.ownerships {
+		c.ownerships[chatID] = append([]entities.OwnershipChange(nil), changes...)
+	}
+	for chatID, p := range st.policies {
+		c.policies[chatID] = p
+	}
+	for chatID, rs := range st.roles {
+		c.roles[chatID] = make(map[entities.Role]entities.ChatRole, len(rs))
+		for name, r := range rs {
+			c.roles[chatID][name] = r
+		}
+	}
+	for id, ch := range st.chats {
+		cp := *ch
+		c.chats[id] = &cp
+	}
+	for chatID, ms := range st.members {
+		c.members[chatID] = make(map[string]entities.Role, len(ms))
+		for userID, role := range ms {
+			c.members[chatID][userID] = role
+		}
+	}
+	return c
+}
+
+// Storage is safe for concurrent use. Transactions are serialized: a transaction
+// holds the storage lock until it is committed or rolled back.
+type Storage struct {
+	mu    *sync.Mutex
+	state *state
+	inTx  bool
+}
+
+func New() *Storage {
+	st := &state{
+		chats:    make(map[string]*entities.Chat),
+		members:  make(map[string]map[string]entities.Role),
+		policies: make(map[string]*chats.ChatPolicy),
+		roles:    make(map[string]map[entities.Role]entities.ChatRole),
+
+		joined:     make(map[string]map[string]int64),
+		ownerships: make(map[string][]entities.OwnershipChange),
+		dialogs:    make(map[[2]string]string),
+	}
+	return &Storage{mu: new(sync.Mutex), state: st}
+}
+
+func (s *Storage) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// RunTx ignores opts, transactions are serializable.
+func (s *Storage) RunTx(_ context.Context, _ *storage.TxOptions, f func(st chats.Storage) error) (err error) {
+	if !s.inTx {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	snapshot := s.state.clone()
+	defer func() {
+		if p := recover(); p != nil {
+			*s.state = *snapshot
+			panic(p)
+		}
+		if err != nil {
+			*s.state = *snapshot
+		}
+	}()
+
+	return f(&Storage{mu: s.mu, state: s.state, inTx: true})
+}
+
+func (s *Storage) getChat(chatID string) (*entities.Chat, bool) {
+	ch, ok := s.state.chats[chatID]
+	if !ok || ch.DeletedAt != nil {
+		return nil, false
+	}
+	return ch, true
+}
+
+func (s *Storage) CreateChat(_ context.Context, ch *entities.Chat) error {
+	const op = "Storage.CreateChat"
+	defer s.lock()()
+
+	if _, ok := s.state.chats[ch.ID]; ok {
+		return errors.Wrap(errors.Errorf("chat '%s' already exists", ch.ID), op)
+	}
+	s.state.chats[ch.ID] = &entities.Chat{
+		ID:          ch.ID,
+		Type:        ch.Type,
+		Name:        ch.Name,
+		Description: ch.Description,
+		AvatarURL:   ch.AvatarURL,
+	}
+	return nil
+}
+
+func (s *Storage) UpdateChat(_ context.Context, ch *entities.Chat) error {
+	const op = "Storage.UpdateChat"
+	defer s.lock()()
+
+	stored, ok := s.getChat(ch.ID)
+	if !ok {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+	stored.Name = ch.Name
+	stored.Description = ch.Description
+	stored.AvatarURL = ch.AvatarURL
+	return nil
+}
+
+func (s *Storage) GetChat(_ context.Context, chatID string) (*entities.Chat, error) {
+	const op = "Storage.GetChat"
+	defer s.lock()()
+
+	stored, ok := s.getChat(chatID)
+	if !ok {
+		return nil, errors.Wrap(chats.ErrNotFound, op)
+	}
+	ch := *stored
+	return &ch, nil
+}
+
+// GetChatForUpdate is GetChat, transactions hold the storage lock anyway.
+func (s *Storage) GetChatForUpdate(ctx context.Context, chatID string) (*entities.Chat, error) {
+	return s.GetChat(ctx, chatID)
+}
+
+func (s *Storage) GetChatPolicy(_ context.Context, chatID string) (*chats.ChatPolicy, error) {
+	const op = "Storage.GetChatPolicy"
+	defer s.lock()()
+
+	if _, ok := s.getChat(chatID); !ok {
+		return nil, errors.Wrap(chats.ErrNotFound, op)
+	}
+	return copyPolicy(s.state.policies[chatID]), nil
+}
+
+func (s *Storage) SetChatPolicy(_ context.Context, chatID string, policy *chats.ChatPolicy) error {
+	const op = "Storage.SetChatPolicy"
+	defer s.lock()()
+
+	if _, ok := s.getChat(chatID); !ok {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+	if policy == nil {
+		delete(s.state.policies, chatID)
+		return nil
+	}
+	s.state.policies[chatID] = copyPolicy(policy)
+	return nil
+}
+
+func (s *Storage) SetChatRole(_ context.Context, chatID string, role *entities.ChatRole) error {
+	defer s.lock()()
+
+	if s.state.roles[chatID] == nil {
+		s.state.roles[chatID] = make(map[entities.Role]entities.ChatRole)
+	}
+	s.state.roles[chatID][role.Name] = *role
+	return nil
+}
+
+func (s *Storage) GetChatRole(_ context.Context, chatID string, name entities.Role) (*entities.ChatRole, error) {
+	const op = "Storage.GetChatRole"
+	defer s.lock()()
+
+	role, ok := s.state.roles[chatID][name]
+	if !ok {
+		return nil, errors.Wrap(chats.ErrNotFound, op)
+	}
+	return &role, nil
+}
+
+func (s *Storage) FindChatRoles(_ context.Context, chatID string) ([]*entities.ChatRole, error) {
+	defer s.lock()()
+
+	res := make([]*entities.ChatRole, 0, len(s.state.roles[chatID]))
+	for _, role := range s.state.roles[chatID] {
+		role := role
+		res = append(res, &role)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Rank != res[j].Rank {
+			return res[i].Rank > res[j].Rank
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+func (s *Storage) DeleteChatRole(_ context.Context, chatID string, name entities.Role) error {
+	const op = "Storage.DeleteChatRole"
+	defer s.lock()()
+
+	if _, ok := s.state.roles[chatID][name]; !ok {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+	delete(s.state.roles[chatID], name)
+	return nil
+}
+
+func copyPolicy(p *chats.ChatPolicy) *chats.ChatPolicy {
+	if p == nil {
+		return nil
+	}
+	cp := *p
+	cp.AddMembers = append([]entities.Role(nil), p.AddMembers...)
+	cp.EditChat = append([]entities.Role(nil), p.EditChat...)
+	return &cp
+}
+
+func (s *Storage) DeleteChat(_ context.Context, chatID string, force ...bool) error {
+	const op = "Storage.DeleteChat"
+	defer s.lock()()
+
+	if len(force) > 0 && force[0] {
+		if stored, ok := s.state.chats[chatID]; !ok || stored.DeletedAt == nil {
+			return errors.Wrap(chats.ErrNotFound, op)
+		}
+		delete(s.state.chats, chatID)
+		delete(s.state.members, chatID)
+		delete(s.state.joined, chatID)
+		delete(s.state.policies, chatID)
+		delete(s.state.roles, chatID)
+		delete(s.state.ownerships, chatID)
+		return nil
+	}
+
+	stored, ok := s.getChat(chatID)
+	if !ok {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+	now := time.Now().UTC()
+	stored.DeletedAt = &now
+	return nil
+}
+
+func (s *Storage) GetDeletedChat(_ context.Context, chatID string) (*entities.Chat, error) {
+	const op = "Storage.GetDeletedChat"
+	defer s.lock()()
+
+	stored, ok := s.state.chats[chatID]
+	if !ok || stored.DeletedAt == nil {
+		return nil, errors.Wrap(chats.ErrNotFound, op)
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (s *Storage) RestoreChat(_ context.Context, chatID string) error {
+	const op = "Storage.RestoreChat"
+	defer s.lock()()
+
+	stored, ok := s.state.chats[chatID]
+	if !ok || stored.DeletedAt == nil {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+
+	// пара собеседников восстанавливается по участникам диалога
+	if stored.Type == entities.DialogType && len(s.state.members[chatID]) == 2 {
+		var userIDs []string
+		for userID := range s.state.members[chatID] {
+			userIDs = append(userIDs, userID)
+		}
+		users := dialogUsers(userIDs[0], userIDs[1])
+		if id, ok := s.state.dialogs[users]; ok && id != chatID {
+			if _, ok := s.getChat(id); ok {
+				return errors.Wrap(chats.ErrDialogExists, op)
+			}
+		}
+		s.state.dialogs[users] = chatID
+	}
+
+	stored.DeletedAt = nil
+	return nil
+}
+
+func (s *Storage) FindDeletedChatIDs(_ context.Context, before time.Time, limit uint) ([]string, error) {
+	defer s.lock()()
+
+	var res []*entities.Chat
+	for _, ch := range s.state.chats {
+		if ch.DeletedAt != nil && ch.DeletedAt.Before(before) {
+			res = append(res, ch)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].DeletedAt.Equal(*res[j].DeletedAt) {
+			return res[i].DeletedAt.Before(*res[j].DeletedAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	if limit > 0 && uint(len(res)) > limit {
+		res = res[:limit]
+	}
+
+	ids := make([]string, len(res))
+	for i, ch := range res {
+		ids[i] = ch.ID
+	}
+	return ids, nil
+}
+
+func (s *Storage) SetMember(_ context.Context, chatID, userID string, role entities.Role) (bool, error) {
+	const op = "Storage.SetMember"
+	defer s.lock()()
+
+	stored, ok := s.getChat(chatID)
+	if !ok {
+		return false, errors.Wrap(chats.ErrNotFound, op)
+	}
+
+	ms := s.state.members[chatID]
+	if ms == nil {
+		ms = make(map[string]entities.Role)
+		s.state.members[chatID] = ms
+	}
+	if _, ok := ms[userID]; ok {
+		ms[userID] = role
+		return false, nil
+	}
+
+	if s.state.joined[chatID] == nil {
+		s.state.joined[chatID] = make(map[string]int64)
+	}
+	s.state.joinSeq++
+	s.state.joined[chatID][userID] = s.state.joinSeq
+	ms[userID] = role
+	stored.NumMembers++
+	return true, nil
+}
+
+func (s *Storage) AddSubscriber(_ context.Context, chatID, userID string, role entities.Role) (bool, error) {
+	const op = "Storage.AddSubscriber"
+	defer s.lock()()
+
+	stored, ok := s.getChat(chatID)
+	if !ok {
+		return false, errors.Wrap(chats.ErrNotFound, op)
+	}
+	if _, ok := s.state.members[chatID][userID]; ok {
+		return false, nil
+	}
+
+	if s.state.members[chatID] == nil {
+		s.state.members[chatID] = make(map[string]entities.Role)
+	}
+	if s.state.joined[chatID] == nil {
+		s.state.joined[chatID] = make(map[string]int64)
+	}
+	s.state.joinSeq++
+	s.state.joined[chatID][userID] = s.state.joinSeq
+	s.state.members[chatID][userID] = role
+	stored.NumMembers++
+	return true, nil
+}
+
+func (s *Storage) ReconcileMemberCounts(_ context.Context) (int, error) {
+	defer s.lock()()
+
+	var n int
+	for chatID, chat := range s.state.chats {
+		if num := len(s.state.members[chatID]); chat.NumMembers != num {
+			chat.NumMembers = num
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Storage) DeleteMembers(_ context.Context, chatID string, userID ...string) (int, error) {
+	const op = "Storage.DeleteMembers"
+	defer s.lock()()
+
+	ms := s.state.members[chatID]
+
+	var deleted int
+	if len(userID) == 0 {
+		deleted = len(ms)
+		delete(s.state.members, chatID)
+		delete(s.state.joined, chatID)
+	} else {
+		for _, id := range userID {
+			if _, ok := ms[id]; ok {
+				delete(ms, id)
+				delete(s.state.joined[chatID], id)
+				deleted++
+			}
+		}
+	}
+
+	stored, ok := s.getChat(chatID)
+	if !ok {
+		return 0, errors.Wrap(chats.ErrNotFound, op)
+	}
+	stored.NumMembers -= deleted
+	return deleted, nil
+}
+
+func (s *Storage) GetRole(_ context.Context, chatID, userID string) (entities.Role, error) {
+	const op = "Storage.GetRole"
+	defer s.lock()()
+
+	role, ok := s.state.members[chatID][userID]
+	if !ok {
+		return "", errors.Wrap(chats.ErrNotFound, op)
+	}
+	return role, nil
+}
+
+func (s *Storage) FindChatMembers(_ context.Context, chatID string, filter *chats.FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error) {
+	const op = "Storage.FindChatMembers"
+	defer s.lock()()
+
+	scope := util.CursorScope("chat_members", chatID, filter)
+	keyset, err := options.Keyset(scope)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	if filter == nil {
+		filter = new(chats.FindChatMembersFilter)
+	}
+
+	res := make([]*entities.ChatMember, 0, len(s.state.members[chatID]))
+	for userID, role := range s.state.members[chatID] {
+		if len(filter.Roles) > 0 && !containsRole(filter.Roles, role) {
+			continue
+		}
+		res = append(res, &entities.ChatMember{UserID: userID, Role: role})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].UserID < res[j].UserID
+	})
+
+	key := func(m *entities.ChatMember) string { return m.UserID }
+	res, page := util.NewPage(paginateByKey(res, key, options, keyset), key, options, keyset, scope)
+	return res, page, nil
+}
+
+func (s *Storage) GetDialog(_ context.Context, userID1, userID2 string) (*entities.Chat, error) {
+	const op = "Storage.GetDialog"
+	defer s.lock()()
+
+	stored, ok := s.getChat(s.state.dialogs[dialogUsers(userID1, userID2)])
+	if !ok {
+		return nil, errors.Wrap(chats.ErrNotFound, op)
+	}
+	cp := *stored
+	return &cp, nil
+}
+
+func (s *Storage) SetDialogUsers(_ context.Context, chatID, userID1, userID2 string) error {
+	const op = "Storage.SetDialogUsers"
+	defer s.lock()()
+
+	if _, ok := s.getChat(chatID); !ok {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+	users := dialogUsers(userID1, userID2)
+	if id, ok := s.state.dialogs[users]; ok && id != chatID {
+		if _, ok := s.getChat(id); ok {
+			return errors.Wrap(chats.ErrDialogExists, op)
+		}
+	}
+	s.state.dialogs[users] = chatID
+	return nil
+}
+
+func dialogUsers(userID1, userID2 string) [2]string {
+	if userID1 > userID2 {
+		return [2]string{userID2, userID1}
+	}
+	return [2]string{userID1, userID2}
+}
+
+func (s *Storage) GetOldestMember(_ context.Context, chatID string, role entities.Role) (*entities.ChatMember, error) {
+	const op = "Storage.GetOldestMember"
+	defer s.lock()()
+
+	var res *entities.ChatMember
+	for userID, r := range s.state.members[chatID] {
+		if r != role {
+			continue
+		}
+		if res == nil || s.state.joined[chatID][userID] < s.state.joined[chatID][res.UserID] {
+			res = &entities.ChatMember{UserID: userID, Role: role}
+		}
+	}
+	if res == nil {
+		return nil, errors.Wrap(chats.ErrNotFound, op)
+	}
+	return res, nil
+}
+
+func (s *Storage) AddOwnershipChange(_ context.Context, change *entities.OwnershipChange) error {
+	defer s.lock()()
+
+	s.state.ownerships[change.ChatID] = append(s.state.ownerships[change.ChatID], *change)
+	return nil
+}
+
+func (s *Storage) FindOwnershipChanges(_ context.Context, chatID string) ([]*entities.OwnershipChange, error) {
+	defer s.lock()()
+
+	res := make([]*entities.OwnershipChange, len(s.state.ownerships[chatID]))
+	for i := range s.state.ownerships[chatID] {
+		change := s.state.ownerships[chatID][i]
+		res[i] = &change
+	}
+	return res, nil
+}
+
+func (s *Storage) FindMemberChatIDs(_ context.Context, userID string) ([]string, error) {
+	defer s.lock()()
+
+	res := make([]string, 0)
+	for chatID, ms := range s.state.members {
+		if _, ok := s.getChat(chatID); !ok {
+			continue
+		}
+		if _, ok := ms[userID]; ok {
+			res = append(res, chatID)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (s *Storage) DeleteMemberOfDeletedChats(_ context.Context, userID string) (int, error) {
+	defer s.lock()()
+
+	var n int
+	for chatID, ms := range s.state.members {
+		stored, ok := s.state.chats[chatID]
+		if !ok || stored.DeletedAt == nil {
+			continue
+		}
+		if _, ok := ms[userID]; !ok {
+			continue
+		}
+		delete(ms, userID)
+		delete(s.state.joined[chatID], userID)
+		stored.NumMembers--
+		n++
+	}
+	return n, nil
+}
+
+func (s *Storage) FindChats(_ context.Context, filter *chats.FindChatsFilter, options *util.PaginationOptions, sortOptions *util.SortOptions) ([]*entities.Chat, *util.Page, error) {
+	const op = "Storage.FindChats"
+	defer s.lock()()
+
+	if err := chats.ValidateSort(sortOptions); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	scope := util.CursorScope("chats", filter)
+	keyset, err := options.Keyset(scope)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	var fields []util.SortField
+	if sortOptions != nil {
+		fields = sortOptions.Sort
+	}
+	if len(fields) > 0 && keyset != nil {
+		return nil, nil, errors.Wrap(chats.ErrCursorWithSort, op)
+	}
+
+	if filter == nil {
+		filter = new(chats.FindChatsFilter)
+	}
+
+	res := make([]*entities.Chat, 0)
+	for _, ch := range s.state.chats {
+		if filter.MemberID != "" {
+			if _, ok := s.state.members[ch.ID][filter.MemberID]; !ok {
+				continue
+			}
+		}
+		if len(filter.Types) > 0 && !containsType(filter.Types, ch.Type) {
+			continue
+		}
+		if filter.Name != "" && !strings.Contains(strings.ToLower(ch.Name), strings.ToLower(filter.Name)) {
+			continue
+		}
+		if !filter.IncludeDeleted && ch.DeletedAt != nil {
+			continue
+		}
+		cp := *ch
+		res = append(res, &cp)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		for _, f := range fields {
+			c := chatColumns[chats.SortFields[f.Name]](res[i], res[j])
+			if f.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return res[i].ID < res[j].ID
+	})
+
+	total := len(res)
+
+	page := new(util.Page)
+	if len(fields) > 0 {
+		if options != nil && options.Limit != 0 {
+			res = paginate(res, options)
+		}
+	} else {
+		key := func(c *entities.Chat) string { return c.ID }
+		res, page = util.NewPage(paginateByKey(res, key, options, keyset), key, options, keyset, scope)
+	}
+	page.Total = total
+
+	return res, page, nil
+}
+
+// chatColumns compare chats by a column the same way the database does.
+var chatColumns = map[string]func(a, b *entities.Chat) int{
+	"id":          func(a, b *entities.Chat) int { return strings.Compare(a.ID, b.ID) },
+	"name":        func(a, b *entities.Chat) int { return strings.Compare(a.Name, b.Name) },
+	"type":        func(a, b *entities.Chat) int { return strings.Compare(string(a.Type), string(b.Type)) },
+	"num_members": func(a, b *entities.Chat) int { return a.NumMembers - b.NumMembers },
+}
+
+func containsRole(roles []entities.Role, role entities.Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []entities.ChatType, typ entities.ChatType) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// paginateByKey does what storage.Paginate does with items sorted by key.
+func paginateByKey[T any](items []T, key func(T) string, options *util.PaginationOptions, keyset *util.Keyset) []T {
+	if keyset != nil {
+		res := make([]T, 0, len(items))
+		for _, item := range items {
+			if keyset.Backward && key(item) < keyset.Key || !keyset.Backward && key(item) > keyset.Key {
+				res = append(res, item)
+			}
+		}
+		if keyset.Backward {
+			for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+				res[i], res[j] = res[j], res[i]
+			}
+		}
+		items = res
+	}
+
+	if options == nil || options.Limit == 0 {
+		return items
+	}
+	if keyset == nil {
+		if int(options.Offset) >= len(items) {
+			return items[:0]
+		}
+		items = items[options.Offset:]
+	}
+	if int(options.Limit)+1 < len(items) {
+		items = items[:options.Limit+1]
+	}
+	return items
+}
+
+func paginate[T any](items []T, options *util.PaginationOptions) []T {
+	if int(options.Offset) >= len(items) {
+		return items[:0]
+	}
+	items = items[options.Offset:]
+	if int(options.Limit) < len(items) {
+		items = items[:options.Limit]
+	}
+	return items
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/alenapetraki/chat/services/chats"
+	"github.com/alenapetraki/chat/storage/chats/chatstest"
+)
+
+func TestStorage(t *testing.T) {
+	chatstest.Run(t, func() chats.Storage {
+		return New()
+	})
+}
@@ -3,6 +3,10 @@ package chats
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/alenapetraki/chat/entities"
@@ -10,7 +14,6 @@ import (
 	"github.com/alenapetraki/chat/storage"
 	"github.com/alenapetraki/chat/util"
 	//"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -18,16 +21,26 @@ type Storage struct {
 	storage.DB
 }
 
+// memberCountShards is the number of shards of member counters.
+const memberCountShards = 16
+
+// numMembers is the number of members with their sharded counters.
+const numMembers = "num_members + COALESCE((SELECT SUM(delta) FROM member_count WHERE member_count.chat_id = chat.id), 0) AS num_members"
+
 func New(db storage.DB) *Storage {
 	return &Storage{DB: db}
 }
 
-var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+func (s *Storage) RunTx(ctx context.Context, opts *storage.TxOptions, f func(st chats.Storage) error) error {
+	return s.DB.RunTx(ctx, opts, func(tx *storage.Transaction) error {
+		return f(New(tx))
+	})
+}
 
 func (s *Storage) CreateChat(ctx context.Context, chat *entities.Chat) error {
 	const op = "Storage.CreateChat"
 
-	_, err := psql.Insert("chat").
+	_, err := s.Builder().Insert("chat").
 		Columns("id", "type", "name", "description", "avatar_url").
 		Values(chat.ID, chat.Type, chat.Name, chat.Description, chat.AvatarURL).
 		RunWith(s.DB).ExecContext(ctx)
@@ -42,7 +55,7 @@ func (s *Storage) UpdateChat(ctx context.Context, chat *entities.Chat) error {
 
 	const op = "Storage.UpdateChat"
 
-	res, err := psql.Update("chat").
+	res, err := s.Builder().Update("chat").
 		Set("name", chat.Name).
 		Set("description", chat.Description).
 		Set("avatar_url", chat.AvatarURL).
@@ -67,7 +80,7 @@ func (s *Storage) UpdateChat(ctx context.Context, chat *entities.Chat) error {
 
 func (s *Storage) incrementChatMembersCount(ctx context.Context, chatID string, delta int) (int, error) {
 
-	row := psql.Update("chat").
+	row := s.Builder().Update("chat").
 		Set("num_members", sq.Expr("num_members + ?", delta)).
 		Where(
 			sq.Eq{
@@ -91,19 +104,32 @@ func (s *Storage) incrementChatMembersCount(ctx context.Context, chatID string,
 }
 
 func (s *Storage) GetChat(ctx context.Context, chatID string) (*entities.Chat, error) {
+	chat, err := s.getChat(ctx, chatID, false)
+	return chat, errors.Wrap(err, "Storage.GetChat")
+}
 
-	const op = "Storage.GetChat"
+// GetChatForUpdate locks the chat row in Postgres. SQLite write transactions
+// lock the whole database when they begin, so there is nothing to lock.
+func (s *Storage) GetChatForUpdate(ctx context.Context, chatID string) (*entities.Chat, error) {
+	chat, err := s.getChat(ctx, chatID, s.Driver() == storage.Postgres)
+	return chat, errors.Wrap(err, "Storage.GetChatForUpdate")
+}
+
+func (s *Storage) getChat(ctx context.Context, chatID string, forUpdate bool) (*entities.Chat, error) {
 
-	row := psql.Select("type", "name", "num_members", "description", "avatar_url").
+	query := s.Builder().Select("type", "name", numMembers, "description", "avatar_url").
 		From("chat").
 		Where(
 			sq.Eq{
 				"id":         chatID,
 				"deleted_at": nil,
 			},
-		).
-		RunWith(s.DB).
-		QueryRowContext(ctx)
+		)
+	if forUpdate {
+		query = query.Suffix("FOR UPDATE")
+	}
+
+	row := query.RunWith(s.DB).QueryRowContext(ctx)
 
 	chat := entities.Chat{ID: chatID}
 
@@ -118,33 +144,99 @@ func (s *Storage) GetChat(ctx context.Context, chatID string) (*entities.Chat, e
 		if errors.Is(err, sql.ErrNoRows) {
 			err = chats.ErrNotFound
 		}
-		return nil, errors.Wrap(err, op)
+		return nil, err
 	}
 
 	return &chat, nil
 }
 
+func (s *Storage) GetChatPolicy(ctx context.Context, chatID string) (*chats.ChatPolicy, error) {
+
+	const op = "Storage.GetChatPolicy"
+
+	var data []byte
+	err := s.Builder().Select("policy").
+		From("chat").
+		Where(
+			sq.Eq{
+				"id":         chatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		QueryRowContext(ctx).
+		Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = chats.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	if data == nil {
+		return nil, nil
+	}
+	policy := new(chats.ChatPolicy)
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return policy, nil
+}
+
+func (s *Storage) SetChatPolicy(ctx context.Context, chatID string, policy *chats.ChatPolicy) error {
+
+	const op = "Storage.SetChatPolicy"
+
+	var data *string
+	if policy != nil {
+		b, err := json.Marshal(policy)
+		if err != nil {
+			return errors.Wrap(err, op)
+		}
+		str := string(b)
+		data = &str
+	}
+
+	res, err := s.Builder().Update("chat").
+		Set("policy", data).
+		Where(
+			sq.Eq{
+				"id":         chatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+
+	return nil
+}
+
+// DeleteChat marks the chat deleted keeping its members, so that it can be restored.
+// Forced deletion removes the chat marked deleted with its members.
 func (s *Storage) DeleteChat(ctx context.Context, chatID string, force ...bool) error {
 	const op = "Storage.DeleteChat"
 
-	var (
-		query string
-		args  []any
-	)
 	if len(force) > 0 && force[0] {
-		query, args = psql.Delete("chat").Where(sq.Eq{"id": chatID}).MustSql()
-	} else {
-		query, args = psql.Update("chat").
-			Where(
-				sq.Eq{
-					"id":         chatID,
-					"deleted_at": nil,
-				},
-			).
-			MustSql()
+		return errors.Wrap(s.purgeChat(ctx, chatID), op)
 	}
 
-	res, err := s.DB.ExecContext(ctx, query, args...)
+	res, err := s.Builder().Update("chat").
+		Set("deleted_at", time.Now().UTC()).
+		Where(
+			sq.Eq{
+				"id":         chatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
 	if err != nil {
 		return errors.Wrap(err, op)
 	}
@@ -156,28 +248,228 @@ func (s *Storage) DeleteChat(ctx context.Context, chatID string, force ...bool)
 	return nil
 }
 
-func (s *Storage) SetMember(ctx context.Context, chatID, userID string, role entities.Role) error {
-	const op = "Storage.SetMember"
-
-	//return storage.RunTx(ctx, s.db,  func(tx *sql.Tx) error {
-	_, err := psql.Insert("member").
-		Columns("chat_id", "user_id", "role").
-		Values(chatID, userID, role).
-		Suffix("ON CONFLICT (user_id, chat_id) DO UPDATE SET user_id = ?", role).
+// purgeChat removes the chat marked deleted, its members and roles are removed
+// only if it is, so that a chat restored meanwhile is not touched.
+func (s *Storage) purgeChat(ctx context.Context, chatID string) error {
+	res, err := s.Builder().Delete("chat").
+		Where(
+			sq.And{
+				sq.Eq{"id": chatID},
+				sq.NotEq{"deleted_at": nil},
+			},
+		).
 		RunWith(s.DB).
 		ExecContext(ctx)
 	if err != nil {
-		return errors.Wrap(err, op)
+		return err
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return chats.ErrNotFound
+	}
+
+	for _, table := range []string{"member", "chat_role", "ownership_change", "member_count"} {
+		if _, err := s.Builder().Delete(table).
+			Where(sq.Eq{"chat_id": chatID}).
+			RunWith(s.DB).
+			ExecContext(ctx); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// GetDeletedChat returns the chat marked deleted, ErrNotFound if it is not deleted.
+func (s *Storage) GetDeletedChat(ctx context.Context, chatID string) (*entities.Chat, error) {
+	const op = "Storage.GetDeletedChat"
+
+	row := s.Builder().Select("type", "name", numMembers, "description", "avatar_url", "deleted_at").
+		From("chat").
+		Where(
+			sq.And{
+				sq.Eq{"id": chatID},
+				sq.NotEq{"deleted_at": nil},
+			},
+		).
+		RunWith(s.DB).
+		QueryRowContext(ctx)
 
-	_, err = s.incrementChatMembersCount(ctx, chatID, 1)
+	chat := entities.Chat{ID: chatID}
+	var deletedAt time.Time
+	err := row.Scan(
+		&chat.Type,
+		&chat.Name,
+		&chat.NumMembers,
+		&chat.Description,
+		&chat.AvatarURL,
+		&deletedAt,
+	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = chats.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+	chat.DeletedAt = &deletedAt
+
+	return &chat, nil
+}
+
+// RestoreChat unmarks the deleted chat. A dialog is not restored if its users have another one.
+func (s *Storage) RestoreChat(ctx context.Context, chatID string) error {
+	const op = "Storage.RestoreChat"
+
+	res, err := s.Builder().Update("chat").
+		Set("deleted_at", nil).
+		Where(
+			sq.And{
+				sq.Eq{"id": chatID},
+				sq.NotEq{"deleted_at": nil},
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		if storage.IsUniqueViolation(err) {
+			err = chats.ErrDialogExists
+		}
 		return errors.Wrap(err, op)
 	}
 
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+
 	return nil
 }
 
+// FindDeletedChatIDs returns up to limit chats deleted before the time, the earliest deleted first.
+func (s *Storage) FindDeletedChatIDs(ctx context.Context, before time.Time, limit uint) ([]string, error) {
+	const op = "Storage.FindDeletedChatIDs"
+
+	rows, err := s.Builder().Select("id").
+		From("chat").
+		Where(sq.Lt{"deleted_at": before}).
+		OrderBy("deleted_at", "id").
+		Limit(uint64(limit)).
+		RunWith(s.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+
+	return ids, nil
+}
+
+// SetMember adds the member or changes the role of an existing one. Only added members are counted.
+func (s *Storage) SetMember(ctx context.Context, chatID, userID string, role entities.Role) (bool, error) {
+	const op = "Storage.SetMember"
+
+	res, err := s.Builder().Insert("member").
+		Columns("chat_id", "user_id", "role", "joined_at").
+		Values(chatID, userID, role, time.Now().UTC()).
+		Suffix("ON CONFLICT (user_id, chat_id) DO NOTHING").
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num > 0 {
+		if _, err := s.incrementChatMembersCount(ctx, chatID, 1); err != nil {
+			return false, errors.Wrap(err, op)
+		}
+		return true, nil
+	}
+
+	_, err = s.Builder().Update("member").
+		Set("role", role).
+		Where(
+			sq.Eq{
+				"chat_id": chatID,
+				"user_id": userID,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	return false, nil
+}
+
+// AddSubscriber adds the member unless the user is a member already. Instead of the chat row
+// it updates a random shard of the member counter, so that concurrent joins rarely contend.
+func (s *Storage) AddSubscriber(ctx context.Context, chatID, userID string, role entities.Role) (bool, error) {
+	const op = "Storage.AddSubscriber"
+
+	if _, err := s.getChat(ctx, chatID, false); err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	res, err := s.Builder().Insert("member").
+		Columns("chat_id", "user_id", "role", "joined_at").
+		Values(chatID, userID, role, time.Now().UTC()).
+		Suffix("ON CONFLICT (user_id, chat_id) DO NOTHING").
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+	if num, _ := res.RowsAffected(); num == 0 {
+		return false, nil
+	}
+
+	_, err = s.Builder().Insert("member_count").
+		Columns("chat_id", "shard", "delta").
+		Values(chatID, rand.Intn(memberCountShards), 1).
+		Suffix("ON CONFLICT (chat_id, shard) DO UPDATE SET delta = member_count.delta + 1").
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, op)
+	}
+
+	return true, nil
+}
+
+// ReconcileMemberCounts fixes num_members of chats so that together with the sharded
+// counters it is the number of their members.
+func (s *Storage) ReconcileMemberCounts(ctx context.Context) (int, error) {
+	const op = "Storage.ReconcileMemberCounts"
+
+	actual := "(SELECT COUNT(*) FROM member WHERE member.chat_id = chat.id) - " +
+		"COALESCE((SELECT SUM(delta) FROM member_count WHERE member_count.chat_id = chat.id), 0)"
+
+	res, err := s.Builder().Update("chat").
+		Set("num_members", sq.Expr(actual)).
+		Where("num_members <> " + actual).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+	return int(n), nil
+}
+
 func (s *Storage) DeleteMembers(ctx context.Context, chatID string, userID ...string) (int, error) {
 
 	const op = "Storage.DeleteMembers"
@@ -189,7 +481,7 @@ func (s *Storage) DeleteMembers(ctx context.Context, chatID string, userID ...st
 		eq["user_id"] = userID
 	}
 
-	res, err := psql.Delete("member").
+	res, err := s.Builder().Delete("member").
 		Where(eq).RunWith(s.DB).ExecContext(ctx)
 	if err != nil {
 		return 0, errors.Wrap(err, op)
@@ -216,7 +508,7 @@ func (s *Storage) GetRole(ctx context.Context, chatID, userID string) (entities.
 
 	var role entities.Role
 
-	err := psql.Select("role").
+	err := s.Builder().Select("role").
 		From("member").
 		Where(
 			sq.Eq{
@@ -238,24 +530,29 @@ func (s *Storage) GetRole(ctx context.Context, chatID, userID string) (entities.
 	return role, nil
 }
 
-func (s *Storage) FindChatMembers(ctx context.Context, chatID string, options *util.PaginationOptions) ([]*entities.ChatMember, error) {
+func (s *Storage) FindChatMembers(ctx context.Context, chatID string, filter *chats.FindChatMembersFilter, options *util.PaginationOptions) ([]*entities.ChatMember, *util.Page, error) {
 
 	const op = "Storage.FindChatMembers"
 
-	query := psql.Select("user_id", "role").
-		From("member").
-		Where(
-			sq.Eq{"chat_id": chatID},
-		).
-		OrderBy("role", "user_id")
+	scope := util.CursorScope("chat_members", chatID, filter)
+	keyset, err := options.Keyset(scope)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
 
-	if options != nil && options.Limit != 0 {
-		query = query.Limit(uint64(options.Limit)).Offset(uint64(options.Offset))
+	where := sq.And{sq.Eq{"chat_id": chatID}}
+	if filter != nil && len(filter.Roles) > 0 {
+		where = append(where, sq.Eq{"role": filter.Roles})
 	}
 
+	query := s.Builder().Select("user_id", "role").
+		From("member").
+		Where(where)
+	query = storage.Paginate(query, "user_id", false, options, keyset)
+
 	rows, err := query.RunWith(s.DB).QueryContext(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, errors.Wrap(err, op)
 	}
 	defer rows.Close()
 
@@ -263,19 +560,423 @@ func (s *Storage) FindChatMembers(ctx context.Context, chatID string, options *u
 	for rows.Next() {
 		m := new(entities.ChatMember)
 		//m.Chat = &chats.Chat{ID: chatID}
-		//m.User = new(account.User)
 
 		err := rows.Scan(
 			&m.UserID,
 			&m.Role,
 		)
 		if err != nil {
-			return nil, errors.Wrap(err, op)
+			return nil, nil, errors.Wrap(err, op)
 		}
 
 		res = append(res, m)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	res, page := util.NewPage(res, func(m *entities.ChatMember) string { return m.UserID }, options, keyset, scope)
+	return res, page, nil
+}
+
+func (s *Storage) SetChatRole(ctx context.Context, chatID string, role *entities.ChatRole) error {
+	const op = "Storage.SetChatRole"
+
+	_, err := s.Builder().Insert("chat_role").
+		Columns("chat_id", "name", "rank", "permissions").
+		Values(chatID, role.Name, role.Rank, role.Permissions).
+		Suffix("ON CONFLICT (chat_id, name) DO UPDATE SET rank = excluded.rank, permissions = excluded.permissions").
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetChatRole(ctx context.Context, chatID string, name entities.Role) (*entities.ChatRole, error) {
+	const op = "Storage.GetChatRole"
+
+	role := &entities.ChatRole{Name: name}
+	err := s.Builder().Select("rank", "permissions").
+		From("chat_role").
+		Where(
+			sq.Eq{
+				"chat_id": chatID,
+				"name":    name,
+			},
+		).
+		RunWith(s.DB).
+		QueryRowContext(ctx).
+		Scan(&role.Rank, &role.Permissions)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = chats.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	return role, nil
+}
+
+func (s *Storage) FindChatRoles(ctx context.Context, chatID string) ([]*entities.ChatRole, error) {
+	const op = "Storage.FindChatRoles"
+
+	rows, err := s.Builder().Select("name", "rank", "permissions").
+		From("chat_role").
+		Where(sq.Eq{"chat_id": chatID}).
+		OrderBy("rank DESC", "name").
+		RunWith(s.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]*entities.ChatRole, 0)
+	for rows.Next() {
+		role := new(entities.ChatRole)
+		if err := rows.Scan(&role.Name, &role.Rank, &role.Permissions); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		res = append(res, role)
+	}
+
+	return res, errors.Wrap(rows.Err(), op)
+}
+
+func (s *Storage) DeleteChatRole(ctx context.Context, chatID string, name entities.Role) error {
+	const op = "Storage.DeleteChatRole"
+
+	res, err := s.Builder().Delete("chat_role").
+		Where(
+			sq.Eq{
+				"chat_id": chatID,
+				"name":    name,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+
+	return nil
+}
+
+// GetDialog returns the dialog of two users in any order.
+func (s *Storage) GetDialog(ctx context.Context, userID1, userID2 string) (*entities.Chat, error) {
+	const op = "Storage.GetDialog"
+
+	user1, user2 := dialogUsers(userID1, userID2)
+
+	var chatID string
+	err := s.Builder().Select("id").
+		From("chat").
+		Where(
+			sq.Eq{
+				"dialog_user1": user1,
+				"dialog_user2": user2,
+				"deleted_at":   nil,
+			},
+		).
+		RunWith(s.DB).
+		QueryRowContext(ctx).
+		Scan(&chatID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = chats.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	chat, err := s.getChat(ctx, chatID, false)
+	return chat, errors.Wrap(err, op)
+}
+
+// SetDialogUsers binds the dialog to its users, the pair is unique among chats which are not deleted.
+func (s *Storage) SetDialogUsers(ctx context.Context, chatID, userID1, userID2 string) error {
+	const op = "Storage.SetDialogUsers"
+
+	user1, user2 := dialogUsers(userID1, userID2)
+
+	res, err := s.Builder().Update("chat").
+		Set("dialog_user1", user1).
+		Set("dialog_user2", user2).
+		Where(
+			sq.Eq{
+				"id":         chatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		if storage.IsUniqueViolation(err) {
+			err = chats.ErrDialogExists
+		}
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(chats.ErrNotFound, op)
+	}
+
+	return nil
+}
+
+// dialogUsers orders users of a dialog the way they are stored.
+func dialogUsers(userID1, userID2 string) (string, string) {
+	if userID1 > userID2 {
+		return userID2, userID1
+	}
+	return userID1, userID2
+}
+
+// GetOldestMember returns the member with the role who joined the chat first.
+func (s *Storage) GetOldestMember(ctx context.Context, chatID string, role entities.Role) (*entities.ChatMember, error) {
+	const op = "Storage.GetOldestMember"
+
+	member := &entities.ChatMember{Role: role}
+	err := s.Builder().Select("user_id").
+		From("member").
+		Where(
+			sq.Eq{
+				"chat_id": chatID,
+				"role":    role,
+			},
+		).
+		OrderBy("joined_at", "user_id").
+		Limit(1).
+		RunWith(s.DB).
+		QueryRowContext(ctx).
+		Scan(&member.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = chats.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	return member, nil
+}
+
+func (s *Storage) AddOwnershipChange(ctx context.Context, change *entities.OwnershipChange) error {
+	const op = "Storage.AddOwnershipChange"
+
+	_, err := s.Builder().Insert("ownership_change").
+		Columns("chat_id", "from_user_id", "to_user_id", "reason", "created_at").
+		Values(change.ChatID, change.FromUserID, change.ToUserID, change.Reason, change.CreatedAt).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) FindOwnershipChanges(ctx context.Context, chatID string) ([]*entities.OwnershipChange, error) {
+	const op = "Storage.FindOwnershipChanges"
+
+	rows, err := s.Builder().Select("from_user_id", "to_user_id", "reason", "created_at").
+		From("ownership_change").
+		Where(sq.Eq{"chat_id": chatID}).
+		OrderBy("created_at").
+		RunWith(s.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]*entities.OwnershipChange, 0)
+	for rows.Next() {
+		change := &entities.OwnershipChange{ChatID: chatID}
+		if err := rows.Scan(&change.FromUserID, &change.ToUserID, &change.Reason, &change.CreatedAt); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		res = append(res, change)
+	}
+
+	return res, errors.Wrap(rows.Err(), op)
+}
+
+// FindMemberChatIDs returns IDs of chats the user is a member of, except deleted ones.
+func (s *Storage) FindMemberChatIDs(ctx context.Context, userID string) ([]string, error) {
+
+	const op = "Storage.FindMemberChatIDs"
+
+	rows, err := s.Builder().Select("chat_id").
+		From("member").
+		Where(
+			sq.And{
+				sq.Eq{"user_id": userID},
+				sq.Expr("chat_id IN (SELECT id FROM chat WHERE deleted_at IS NULL)"),
+			},
+		).
+		OrderBy("chat_id").
+		RunWith(s.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]string, 0)
+	for rows.Next() {
+		var chatID string
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		res = append(res, chatID)
+	}
+
+	return res, errors.Wrap(rows.Err(), op)
+}
+
+// DeleteMemberOfDeletedChats removes the user from chats marked deleted, numbers
+// of their members are decreased, so that restored chats have them right.
+func (s *Storage) DeleteMemberOfDeletedChats(ctx context.Context, userID string) (int, error) {
+	const op = "Storage.DeleteMemberOfDeletedChats"
+
+	deleted := sq.Expr("chat_id IN (SELECT id FROM chat WHERE deleted_at IS NOT NULL)")
+
+	_, err := s.Builder().Update("chat").
+		Set("num_members", sq.Expr("num_members - 1")).
+		Where(
+			sq.And{
+				sq.NotEq{"deleted_at": nil},
+				sq.Expr("id IN (SELECT chat_id FROM member WHERE user_id = ?)", userID),
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	res, err := s.Builder().Delete("member").
+		Where(sq.And{sq.Eq{"user_id": userID}, deleted}).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+	return int(n), nil
+}
+
+func (s *Storage) FindChats(ctx context.Context, filter *chats.FindChatsFilter, options *util.PaginationOptions, sort *util.SortOptions) ([]*entities.Chat, *util.Page, error) {
+
+	const op = "Storage.FindChats"
+
+	if err := chats.ValidateSort(sort); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	scope := util.CursorScope("chats", filter)
+	keyset, err := options.Keyset(scope)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	sorted := sort != nil && len(sort.Sort) > 0
+	if sorted && keyset != nil {
+		return nil, nil, errors.Wrap(chats.ErrCursorWithSort, op)
+	}
+
+	where := sq.And{}
+	if filter != nil {
+		if filter.MemberID != "" {
+			where = append(where, sq.Expr("id IN (SELECT chat_id FROM member WHERE user_id = ?)", filter.MemberID))
+		}
+		if len(filter.Types) > 0 {
+			where = append(where, sq.Eq{"type": filter.Types})
+		}
+		if filter.Name != "" {
+			where = append(where, sq.Expr(`lower(name) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.Name))+"%"))
+		}
+	}
+	if filter == nil || !filter.IncludeDeleted {
+		where = append(where, sq.Eq{"deleted_at": nil})
+	}
+
+	var total int
+	if err := s.Builder().Select("count(*)").
+		From("chat").
+		Where(where).
+		RunWith(s.DB).
+		QueryRowContext(ctx).
+		Scan(&total); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	query := s.Builder().Select("id", "type", "name", numMembers, "description", "avatar_url", "deleted_at").
+		From("chat").
+		Where(where)
+
+	if sorted {
+		query = query.OrderBy(chats.SortFields.OrderBy(sort)...).OrderBy("id")
+		if options != nil && options.Limit != 0 {
+			query = query.Limit(uint64(options.Limit)).Offset(uint64(options.Offset))
+		}
+	} else {
+		query = storage.Paginate(query, "id", false, options, keyset)
+	}
+
+	rows, err := query.RunWith(s.DB).QueryContext(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]*entities.Chat, 0)
+	for rows.Next() {
+		var (
+			chat                         entities.Chat
+			name, description, avatarURL sql.NullString
+		)
+		err := rows.Scan(
+			&chat.ID,
+			&chat.Type,
+			&name,
+			&chat.NumMembers,
+			&description,
+			&avatarURL,
+			&chat.DeletedAt,
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, op)
+		}
+		chat.Name = name.String
+		chat.Description = description.String
+		chat.AvatarURL = avatarURL.String
+
+		res = append(res, &chat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	page := new(util.Page)
+	if !sorted {
+		res, page = util.NewPage(res, func(c *entities.Chat) string { return c.ID }, options, keyset, scope)
+	}
+	page.Total = total
+
+	return res, page, nil
+}
 
-	return res, nil
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
 }
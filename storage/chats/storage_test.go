@@ -8,6 +8,8 @@ import (
 	"github.com/alenapetraki/chat/entities"
 	"github.com/alenapetraki/chat/services/chats"
 	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/chats/chatstest"
+	"github.com/alenapetraki/chat/storage/storagetest"
 	"github.com/alenapetraki/chat/util/id"
 	"github.com/stretchr/testify/suite"
 )
@@ -19,27 +21,30 @@ type testSuite struct {
 }
 
 func TestStorage(t *testing.T) {
-	db, err := storage.Connect("postgres", &storage.Config{
-		Host:     "localhost",
-		Port:     "5435",
-		User:     "chat_user",
-		Password: "chat_password",
-		Database: "chat",
-	})
-	if err != nil {
-		panic(err)
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			suite.Run(t, &testSuite{db: storagetest.Connect(t, driver)})
+		})
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			db := storagetest.Connect(t, driver)
+			chatstest.Run(t, func() chats.Storage {
+				storagetest.Truncate(t, db)
+				return New(db)
+			})
+		})
 	}
-	suite.Run(t, &testSuite{db: storage.NewDB(db)})
-	db.Close()
 }
 
 func (t *testSuite) SetupTest() {
 
 	t.st = New(t.db)
 
-	t.db.Exec(`truncate user`)
-	t.db.Exec(`truncate member`)
-	t.db.Exec(`truncate chat`)
+	storagetest.Truncate(t.T(), t.db)
 }
 
 func (t *testSuite) TearDownTest() {
@@ -140,6 +145,52 @@ func (t *testSuite) TestIncrementNumMembers() {
 	t.Assert().Equal("just a chat", chat.Description)
 }
 
+func (t *testSuite) TestReconcileMemberCounts() {
+
+	ctx := context.Background()
+
+	chat := &entities.Chat{
+		ID:   id.MustNewULID(),
+		Type: entities.ChannelType,
+		Name: "channel",
+	}
+	t.Require().NoError(t.st.CreateChat(ctx, chat))
+	for i := 0; i < 3; i++ {
+		_, err := t.st.AddSubscriber(ctx, chat.ID, "user_"+strconv.Itoa(i), entities.RoleSubscriber)
+		t.Require().NoError(err)
+	}
+	other := &entities.Chat{
+		ID:   id.MustNewULID(),
+		Type: entities.GroupType,
+		Name: "group",
+	}
+	t.Require().NoError(t.st.CreateChat(ctx, other))
+	_, err := t.st.SetMember(ctx, other.ID, "user_1", entities.RoleOwner)
+	t.Require().NoError(err)
+
+	// счетчик испорчен старой версией SetMember
+	_, err = t.st.incrementChatMembersCount(ctx, chat.ID, 5)
+	t.Require().NoError(err)
+	got, err := t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Require().Equal(8, got.NumMembers)
+
+	n, err := t.st.ReconcileMemberCounts(ctx)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, n, "Исправляется только испорченный чат")
+
+	got, err = t.st.GetChat(ctx, chat.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(3, got.NumMembers)
+	got, err = t.st.GetChat(ctx, other.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal(1, got.NumMembers)
+
+	n, err = t.st.ReconcileMemberCounts(ctx)
+	t.Require().NoError(err)
+	t.Assert().Equal(0, n)
+}
+
 func (t *testSuite) TestGetChat_NotFound() {
 
 	ctx := context.Background()
@@ -201,7 +252,8 @@ func (t *testSuite) TestMembers() {
 			if j == 0 {
 				role = entities.RoleOwner
 			}
-			t.Require().NoError(t.st.SetMember(ctx, chat.ID, userIDs[j], role))
+			_, err := t.st.SetMember(ctx, chat.ID, userIDs[j], role)
+			t.Require().NoError(err)
 		}
 	}
 
@@ -211,9 +263,15 @@ func (t *testSuite) TestMembers() {
 		t.Assert().Equal(entities.RoleOwner, r)
 	})
 
+	t.Run("find member chats", func() {
+		ids, err := t.st.FindMemberChatIDs(ctx, userIDs[1])
+		t.Require().NoError(err)
+		t.Assert().ElementsMatch(chatIDs[1:], ids)
+	})
+
 	t.Run("delete members", func() {
 
-		ms, err := t.st.FindChatMembers(ctx, chatIDs[2], nil)
+		ms, _, err := t.st.FindChatMembers(ctx, chatIDs[2], nil, nil)
 		t.Require().NoError(err)
 		t.Assert().Len(ms, 3)
 
@@ -221,7 +279,7 @@ func (t *testSuite) TestMembers() {
 		t.Require().NoError(err)
 		t.Assert().Equal(3, n)
 
-		ms, err = t.st.FindChatMembers(ctx, chatIDs[2], nil)
+		ms, _, err = t.st.FindChatMembers(ctx, chatIDs[2], nil, nil)
 		t.Require().NoError(err)
 		t.Assert().Len(ms, 0, "Должны быть удалены все участники чата")
 	})
@@ -231,9 +289,7 @@ func (t *testSuite) TestTX() {
 
 	ctx := context.Background()
 
-	err := t.st.RunTx(func(tx *storage.Transaction) error {
-
-		st := New(tx)
+	err := t.st.RunTx(ctx, nil, func(st chats.Storage) error {
 
 		chat := &entities.Chat{
 			ID:   id.MustNewULID(),
@@ -244,7 +300,7 @@ func (t *testSuite) TestTX() {
 		if err != nil {
 			return err
 		}
-		err = st.SetMember(ctx, chat.ID, "user42", entities.RoleOwner)
+		_, err = st.SetMember(ctx, chat.ID, "user42", entities.RoleOwner)
 		if err != nil {
 			return err
 		}
@@ -4,10 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/alenapetraki/chat/storage/migrations"
 	validation "github.com/go-ozzo/ozzo-validation"
+	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
+	_ "modernc.org/sqlite"
+)
+
+// Supported database drivers.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
 )
 
 type DB interface {
@@ -17,16 +27,40 @@ type DB interface {
 	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
 	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
 	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
-	Begin() (*Transaction, error)
-	RunTx(fn func(tx *Transaction) error) error
+	// Begin starts a transaction, on a transaction it starts a nested one.
+	Begin(ctx context.Context, opts *TxOptions) (*Transaction, error)
+	// RunTx runs fn in a transaction which is committed if fn succeeds and rolled back
+	// if it returns an error or panics.
+	RunTx(ctx context.Context, opts *TxOptions, fn func(tx *Transaction) error) error
+
+	// Driver returns name of the database driver.
+	Driver() string
+	// Builder returns a statement builder with the driver's placeholder format.
+	Builder() sq.StatementBuilderType
 }
 
-func NewDB(sqldb *sql.DB) DB {
-	return &db{db: sqldb}
+func NewDB(sqldb *sql.DB, driver string) DB {
+	return &db{db: sqldb, driver: driver}
 }
 
 type db struct {
-	db *sql.DB
+	db     *sql.DB
+	driver string
+}
+
+func (d *db) Driver() string {
+	return d.driver
+}
+
+func (d *db) Builder() sq.StatementBuilderType {
+	return builder(d.driver)
+}
+
+func builder(driver string) sq.StatementBuilderType {
+	if driver == Postgres {
+		return sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	}
+	return sq.StatementBuilder.PlaceholderFormat(sq.Question)
 }
 
 func (d *db) Exec(sql string, args ...interface{}) (sql.Result, error) {
@@ -53,85 +87,34 @@ func (d *db) QueryRowContext(ctx context.Context, sql string, args ...interface{
 	return d.db.QueryRowContext(ctx, sql, args...)
 }
 
-func (d *db) Begin() (*Transaction, error) {
-	tx, err := d.db.BeginTx(context.Background(), nil)
+func (d *db) Begin(ctx context.Context, opts *TxOptions) (*Transaction, error) {
+	tx, err := d.db.BeginTx(ctx, opts.sqlOptions())
 	if err != nil {
 		return nil, err
 	}
-	return &Transaction{tx: tx}, nil
+	return &Transaction{tx: tx, driver: d.driver}, nil
 }
 
-func (d *db) RunTx(fn func(tx *Transaction) error) error {
-	tx, err := d.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		p := recover()
-		switch {
-		case p != nil:
-			// a panic occurred, rollback and repanic
-			_ = tx.Rollback()
-			panic(p)
-		case err != nil:
-			// something went wrong, rollback
-			_ = tx.Rollback()
-		default:
-			// all good, commit
-			err = tx.Commit()
+// RunTx runs fn in a transaction, see Transaction. Transactions failed because
+// of serialization failures or deadlocks are retried, so fn must not have side effects
+// outside of the transaction.
+func (d *db) RunTx(ctx context.Context, opts *TxOptions, fn func(tx *Transaction) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, d, opts, fn)
+		if err == nil || attempt > maxTxRetries || !IsSerializationFailure(err) {
+			return err
 		}
-	}()
-	err = fn(tx)
-	return err
-}
-
-type Transaction struct {
-	//DB
-	tx *sql.Tx
-}
-
-func (t *Transaction) Exec(sql string, args ...interface{}) (sql.Result, error) {
-	return t.tx.Exec(sql, args...)
-}
 
-func (t *Transaction) Query(sql string, args ...interface{}) (*sql.Rows, error) {
-	return t.tx.Query(sql, args...)
-}
-
-func (t *Transaction) QueryRow(sql string, args ...interface{}) *sql.Row {
-	return t.tx.QueryRow(sql, args...)
-}
-
-func (t *Transaction) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
-	return t.tx.ExecContext(ctx, sql, args...)
-}
-
-func (t *Transaction) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
-	return t.tx.QueryContext(ctx, sql, args...)
-}
-
-func (t *Transaction) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
-	return t.tx.QueryRowContext(ctx, sql, args...)
-}
-
-func (t *Transaction) Commit() error {
-	return t.tx.Commit()
-}
-
-func (t *Transaction) Rollback() error {
-	return t.tx.Rollback()
-}
-
-func (t *Transaction) Begin() (*Transaction, error) {
-	// интересная история с SAVEPOINT вместо возврата ошибки
-	return nil, errors.New("cannot begin tx on tx")
-}
-
-// RunTx exec sql with transaction
-func (t *Transaction) RunTx(_ func(tx *Transaction) error) error {
-	return errors.New("cannot begin tx on tx")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(txRetryBackoff(attempt)):
+		}
+	}
 }
 
+// Config describes a database connection. For SQLite only Database is used
+// as a path to the database file.
 type Config struct {
 	Host     string
 	Port     string
@@ -142,21 +125,12 @@ type Config struct {
 
 func Connect(driver string, config *Config) (*sql.DB, error) {
 
-	if err := validation.ValidateStruct(
-		config,
-		validation.Field(&config.Host, validation.Required),
-		validation.Field(&config.Port, validation.Required),
-		validation.Field(&config.User, validation.Required),
-		validation.Field(&config.Password, validation.Required),
-		validation.Field(&config.Database, validation.Required),
-	); err != nil {
+	dsn, err := dataSourceName(driver, config)
+	if err != nil {
 		return nil, err
 	}
 
-	db, err := sql.Open(driver, fmt.Sprintf(
-		"user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
-		config.User, config.Password, config.Database, config.Host, config.Port),
-	)
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -172,10 +146,45 @@ func Connect(driver string, config *Config) (*sql.DB, error) {
 	return db, nil
 }
 
+func dataSourceName(driver string, config *Config) (string, error) {
+	switch driver {
+	case Postgres:
+		if err := validation.ValidateStruct(
+			config,
+			validation.Field(&config.Host, validation.Required),
+			validation.Field(&config.Port, validation.Required),
+			validation.Field(&config.User, validation.Required),
+			validation.Field(&config.Password, validation.Required),
+			validation.Field(&config.Database, validation.Required),
+		); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(
+			"user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
+			config.User, config.Password, config.Database, config.Host, config.Port,
+		), nil
+	case SQLite:
+		if err := validation.ValidateStruct(
+			config,
+			validation.Field(&config.Database, validation.Required),
+		); err != nil {
+			return "", err
+		}
+		// write transactions take the lock upfront and wait for each other
+		// instead of failing with SQLITE_BUSY
+		return fmt.Sprintf(
+			"file:%s?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate&_time_format=sqlite",
+			config.Database,
+		), nil
+	default:
+		return "", errors.Errorf("unknown db driver '%s'", driver)
+	}
+}
+
 func setupDatabase(db *sql.DB, driver string) error {
 	switch driver {
-	case "postgres":
-		return migrations.Migrate(db)
+	case Postgres, SQLite:
+		return migrations.Migrate(db, driver)
 	default:
 		return errors.Errorf("unknown db driver '%s'", driver)
 	}
@@ -0,0 +1,259 @@
+package messages
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/messages"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/util"
+	"github.com/pkg/errors"
+)
+
+type Storage struct {
+	storage.DB
+}
+
+func New(db storage.DB) *Storage {
+	return &Storage{DB: db}
+}
+
+func (s *Storage) RunTx(ctx context.Context, opts *storage.TxOptions, f func(st messages.Storage) error) error {
+	return s.DB.RunTx(ctx, opts, func(tx *storage.Transaction) error {
+		return f(New(tx))
+	})
+}
+
+func (s *Storage) CreateMessage(ctx context.Context, message *entities.Message) error {
+	const op = "Storage.CreateMessage"
+
+	_, err := s.Builder().Insert("message").
+		Columns("id", "chat_id", "user_id", "body", "created_at").
+		Values(message.ID, message.ChatID, message.UserID, message.Body, message.CreatedAt).
+		RunWith(s.DB).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdateMessage(ctx context.Context, message *entities.Message) error {
+
+	const op = "Storage.UpdateMessage"
+
+	res, err := s.Builder().Update("message").
+		Set("body", message.Body).
+		Set("edited_at", message.EditedAt).
+		Where(
+			sq.Eq{
+				"id":         message.ID,
+				"chat_id":    message.ChatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(messages.ErrNotFound, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetMessage(ctx context.Context, chatID, messageID string) (*entities.Message, error) {
+
+	const op = "Storage.GetMessage"
+
+	row := s.Builder().Select("user_id", "body", "created_at", "edited_at").
+		From("message").
+		Where(
+			sq.Eq{
+				"id":         messageID,
+				"chat_id":    chatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		QueryRowContext(ctx)
+
+	msg := entities.Message{ID: messageID, ChatID: chatID}
+
+	err := row.Scan(
+		&msg.UserID,
+		&msg.Body,
+		&msg.CreatedAt,
+		&msg.EditedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = messages.ErrNotFound
+		}
+		return nil, errors.Wrap(err, op)
+	}
+
+	return &msg, nil
+}
+
+func (s *Storage) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+
+	const op = "Storage.DeleteMessage"
+
+	res, err := s.Builder().Update("message").
+		Set("deleted_at", time.Now().UTC()).
+		Where(
+			sq.Eq{
+				"id":         messageID,
+				"chat_id":    chatID,
+				"deleted_at": nil,
+			},
+		).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(messages.ErrNotFound, op)
+	}
+
+	return nil
+}
+
+// DeleteChatMessages removes all messages of the chat with their revisions, including deleted ones.
+func (s *Storage) DeleteChatMessages(ctx context.Context, chatID string) (int, error) {
+
+	const op = "Storage.DeleteChatMessages"
+
+	if _, err := s.Builder().Delete("message_revision").
+		Where(sq.Expr("message_id IN (SELECT id FROM message WHERE chat_id = ?)", chatID)).
+		RunWith(s.DB).
+		ExecContext(ctx); err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	res, err := s.Builder().Delete("message").
+		Where(sq.Eq{"chat_id": chatID}).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, op)
+	}
+	return int(n), nil
+}
+
+// FindMessages returns chat messages starting from the most recent one.
+func (s *Storage) FindMessages(ctx context.Context, chatID string, options *util.PaginationOptions) ([]*entities.Message, *util.Page, error) {
+
+	const op = "Storage.FindMessages"
+
+	scope := util.CursorScope("messages", chatID)
+	keyset, err := options.Keyset(scope)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	query := s.Builder().Select("id", "user_id", "body", "created_at", "edited_at").
+		From("message").
+		Where(
+			sq.Eq{
+				"chat_id":    chatID,
+				"deleted_at": nil,
+			},
+		)
+	query = storage.Paginate(query, "id", true, options, keyset)
+
+	rows, err := query.RunWith(s.DB).QueryContext(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]*entities.Message, 0)
+	for rows.Next() {
+		m := &entities.Message{ChatID: chatID}
+
+		err := rows.Scan(
+			&m.ID,
+			&m.UserID,
+			&m.Body,
+			&m.CreatedAt,
+			&m.EditedAt,
+		)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, op)
+		}
+
+		res = append(res, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, op)
+	}
+
+	res, page := util.NewPage(res, func(m *entities.Message) string { return m.ID }, options, keyset, scope)
+	return res, page, nil
+}
+
+func (s *Storage) CreateRevision(ctx context.Context, revision *entities.MessageRevision) error {
+	const op = "Storage.CreateRevision"
+
+	_, err := s.Builder().Insert("message_revision").
+		Columns("message_id", "editor_id", "body", "created_at").
+		Values(revision.MessageID, revision.EditorID, revision.Body, revision.CreatedAt).
+		RunWith(s.DB).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+// FindRevisions returns previous bodies of the message in order they were replaced.
+func (s *Storage) FindRevisions(ctx context.Context, messageID string) ([]*entities.MessageRevision, error) {
+
+	const op = "Storage.FindRevisions"
+
+	rows, err := s.Builder().Select("editor_id", "body", "created_at").
+		From("message_revision").
+		Where(
+			sq.Eq{"message_id": messageID},
+		).
+		OrderBy("created_at", "id").
+		RunWith(s.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]*entities.MessageRevision, 0)
+	for rows.Next() {
+		r := &entities.MessageRevision{MessageID: messageID}
+
+		err := rows.Scan(
+			&r.EditorID,
+			&r.Body,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+
+		res = append(res, r)
+	}
+
+	return res, errors.Wrap(rows.Err(), op)
+}
@@ -0,0 +1,259 @@
+package messages
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/messages"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	"github.com/alenapetraki/chat/util"
+	"github.com/alenapetraki/chat/util/id"
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+	db storage.DB
+	st *Storage
+}
+
+func TestStorage(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			suite.Run(t, &testSuite{db: storagetest.Connect(t, driver)})
+		})
+	}
+}
+
+func (t *testSuite) SetupTest() {
+
+	t.st = New(t.db)
+
+	storagetest.Truncate(t.T(), t.db)
+}
+
+func (t *testSuite) TestGetMessage() {
+
+	ctx := context.Background()
+
+	msg := &entities.Message{
+		ID:        id.MustNewULID(),
+		ChatID:    "chat_1",
+		UserID:    "user_1",
+		Body:      "hello",
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	t.Require().NoError(t.st.CreateMessage(ctx, msg))
+
+	{
+		res, err := t.st.GetMessage(ctx, msg.ChatID, msg.ID)
+		t.Require().NoError(err)
+		t.Assert().Equal(msg.UserID, res.UserID)
+		t.Assert().Equal(msg.Body, res.Body)
+		t.Assert().True(msg.CreatedAt.Equal(res.CreatedAt))
+	}
+	{
+		_, err := t.st.GetMessage(ctx, "chat_2", msg.ID)
+		t.Assert().ErrorIs(err, messages.ErrNotFound)
+	}
+}
+
+func (t *testSuite) TestFindMessages() {
+
+	ctx := context.Background()
+
+	msgIDs := make([]string, 5)
+	for i := 0; i < 5; i++ {
+		msg := &entities.Message{
+			ID:        id.MustNewULID(),
+			ChatID:    "chat_1",
+			UserID:    "user_1",
+			Body:      "message " + strconv.Itoa(i),
+			CreatedAt: time.Now().UTC(),
+		}
+		t.Require().NoError(t.st.CreateMessage(ctx, msg))
+		msgIDs[i] = msg.ID
+	}
+
+	{
+		res, _, err := t.st.FindMessages(ctx, "chat_1", nil)
+		t.Require().NoError(err)
+		t.Require().Len(res, 5)
+		t.Assert().Equal(msgIDs[4], res[0].ID, "Сначала должны идти новые сообщения")
+	}
+	{
+		res, _, err := t.st.FindMessages(ctx, "chat_1", &util.PaginationOptions{Limit: 2, Offset: 2})
+		t.Require().NoError(err)
+		t.Require().Len(res, 2)
+		t.Assert().Equal(msgIDs[2], res[0].ID)
+		t.Assert().Equal(msgIDs[1], res[1].ID)
+	}
+	{
+		res, page, err := t.st.FindMessages(ctx, "chat_1", &util.PaginationOptions{Limit: 2})
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{msgIDs[4], msgIDs[3]}, []string{res[0].ID, res[1].ID})
+		t.Assert().Empty(page.PrevCursor)
+
+		res, page, err = t.st.FindMessages(ctx, "chat_1", &util.PaginationOptions{Limit: 2, Cursor: page.NextCursor})
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{msgIDs[2], msgIDs[1]}, []string{res[0].ID, res[1].ID})
+
+		res, page, err = t.st.FindMessages(ctx, "chat_1", &util.PaginationOptions{Limit: 2, Cursor: page.NextCursor})
+		t.Require().NoError(err)
+		t.Require().Len(res, 1)
+		t.Assert().Equal(msgIDs[0], res[0].ID)
+		t.Assert().Empty(page.NextCursor, "Больше сообщений нет")
+
+		res, _, err = t.st.FindMessages(ctx, "chat_1", &util.PaginationOptions{Limit: 2, Cursor: page.PrevCursor})
+		t.Require().NoError(err)
+		t.Assert().Equal([]string{msgIDs[2], msgIDs[1]}, []string{res[0].ID, res[1].ID})
+
+		_, _, err = t.st.FindMessages(ctx, "chat_2", &util.PaginationOptions{Limit: 2, Cursor: page.PrevCursor})
+		t.Assert().ErrorIs(err, util.ErrInvalidCursor, "Курсор другого чата")
+	}
+}
+
+func (t *testSuite) TestUpdateMessage() {
+
+	ctx := context.Background()
+
+	msg := &entities.Message{
+		ID:        id.MustNewULID(),
+		ChatID:    "chat_1",
+		UserID:    "user_1",
+		Body:      "hello",
+		CreatedAt: time.Now().UTC(),
+	}
+	t.Require().NoError(t.st.CreateMessage(ctx, msg))
+
+	editedAt := time.Now().UTC()
+	msg.Body = "hello, world"
+	msg.EditedAt = &editedAt
+	t.Require().NoError(t.st.UpdateMessage(ctx, msg))
+
+	res, err := t.st.GetMessage(ctx, msg.ChatID, msg.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal("hello, world", res.Body)
+	t.Assert().NotNil(res.EditedAt)
+
+	err = t.st.UpdateMessage(ctx, &entities.Message{ID: "not_exist", ChatID: "chat_1", Body: "foo"})
+	t.Assert().ErrorIs(err, messages.ErrNotFound)
+}
+
+func (t *testSuite) TestDeleteMessage() {
+
+	ctx := context.Background()
+
+	msg := &entities.Message{
+		ID:        id.MustNewULID(),
+		ChatID:    "chat_1",
+		UserID:    "user_1",
+		Body:      "hello",
+		CreatedAt: time.Now().UTC(),
+	}
+	t.Require().NoError(t.st.CreateMessage(ctx, msg))
+	t.Require().NoError(t.st.DeleteMessage(ctx, msg.ChatID, msg.ID))
+
+	_, err := t.st.GetMessage(ctx, msg.ChatID, msg.ID)
+	t.Assert().ErrorIs(err, messages.ErrNotFound)
+
+	res, _, err := t.st.FindMessages(ctx, msg.ChatID, nil)
+	t.Require().NoError(err)
+	t.Assert().Len(res, 0)
+
+	err = t.st.DeleteMessage(ctx, msg.ChatID, msg.ID)
+	t.Assert().ErrorIs(err, messages.ErrNotFound, "Повторное удаление должно вернуть ошибку")
+}
+
+func (t *testSuite) TestDeleteChatMessages() {
+
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	var msgIDs []string
+	for i, chatID := range []string{"chat_1", "chat_1", "chat_1", "chat_2"} {
+		msg := &entities.Message{
+			ID:        id.MustNewULID(),
+			ChatID:    chatID,
+			UserID:    "user_1",
+			Body:      "hello " + strconv.Itoa(i),
+			CreatedAt: now,
+		}
+		t.Require().NoError(t.st.CreateMessage(ctx, msg))
+		t.Require().NoError(t.st.CreateRevision(ctx, &entities.MessageRevision{
+			MessageID: msg.ID,
+			EditorID:  "user_1",
+			Body:      msg.Body,
+			CreatedAt: now,
+		}))
+		msgIDs = append(msgIDs, msg.ID)
+	}
+	t.Require().NoError(t.st.DeleteMessage(ctx, "chat_1", msgIDs[0]))
+
+	n, err := t.st.DeleteChatMessages(ctx, "chat_1")
+	t.Require().NoError(err)
+	t.Assert().Equal(3, n, "Удаляются и удаленные сообщения")
+
+	res, _, err := t.st.FindMessages(ctx, "chat_1", nil)
+	t.Require().NoError(err)
+	t.Assert().Empty(res)
+	revs, err := t.st.FindRevisions(ctx, msgIDs[1])
+	t.Require().NoError(err)
+	t.Assert().Empty(revs)
+
+	res, _, err = t.st.FindMessages(ctx, "chat_2", nil)
+	t.Require().NoError(err)
+	t.Assert().Len(res, 1, "Сообщения других чатов не удаляются")
+	revs, err = t.st.FindRevisions(ctx, msgIDs[3])
+	t.Require().NoError(err)
+	t.Assert().Len(revs, 1)
+}
+
+func (t *testSuite) TestRevisions() {
+
+	ctx := context.Background()
+
+	msgID := id.MustNewULID()
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		t.Require().NoError(t.st.CreateRevision(ctx, &entities.MessageRevision{
+			MessageID: msgID,
+			EditorID:  "user_1",
+			Body:      "body " + strconv.Itoa(i),
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	res, err := t.st.FindRevisions(ctx, msgID)
+	t.Require().NoError(err)
+	t.Require().Len(res, 3)
+	t.Assert().Equal("body 0", res[0].Body)
+	t.Assert().Equal("body 2", res[2].Body)
+}
+
+func (t *testSuite) TestRevisions_SameTime() {
+
+	ctx := context.Background()
+
+	msgID := id.MustNewULID()
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		t.Require().NoError(t.st.CreateRevision(ctx, &entities.MessageRevision{
+			MessageID: msgID,
+			EditorID:  "user_1",
+			Body:      "body " + strconv.Itoa(i),
+			CreatedAt: now,
+		}))
+	}
+
+	res, err := t.st.FindRevisions(ctx, msgID)
+	t.Require().NoError(err)
+	t.Require().Len(res, 5)
+	for i, r := range res {
+		t.Assert().Equal("body "+strconv.Itoa(i), r.Body, "Правки с одним временем идут в порядке создания")
+	}
+}
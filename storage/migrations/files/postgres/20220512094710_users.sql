@@ -0,0 +1,19 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS "user" (
+    id text PRIMARY KEY,
+    username text NOT NULL,
+    password_hash text NOT NULL,
+    email text NOT NULL,
+    full_name text,
+    status text
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_username_idx ON "user" (username);
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_idx ON "user" (email);
+
+
+
+-- +goose Down
+DROP TABLE
+    "user";
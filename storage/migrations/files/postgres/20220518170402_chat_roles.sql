@@ -0,0 +1,14 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS chat_role (
+    chat_id text,
+    name text,
+    rank int NOT NULL,
+    permissions int NOT NULL,
+    primary key (chat_id, name)
+);
+
+
+
+-- +goose Down
+DROP TABLE chat_role;
@@ -0,0 +1,27 @@
+-- +goose Up
+
+ALTER TABLE chat ADD COLUMN dialog_user1 text;
+ALTER TABLE chat ADD COLUMN dialog_user2 text;
+
+-- the latest dialog of each pair of users becomes the one of them
+WITH pairs AS (
+    SELECT m.chat_id, min(m.user_id) AS user1, max(m.user_id) AS user2
+    FROM member m JOIN chat c ON c.id = m.chat_id
+    WHERE c.type = 'dialog' AND c.deleted_at IS NULL
+    GROUP BY m.chat_id
+    HAVING count(*) = 2
+)
+UPDATE chat SET dialog_user1 = pairs.user1, dialog_user2 = pairs.user2
+FROM pairs
+WHERE chat.id = pairs.chat_id
+  AND pairs.chat_id = (SELECT max(p.chat_id) FROM pairs p WHERE p.user1 = pairs.user1 AND p.user2 = pairs.user2);
+
+CREATE UNIQUE INDEX IF NOT EXISTS chat_dialog_users_idx ON chat (dialog_user1, dialog_user2) WHERE deleted_at IS NULL;
+
+
+
+-- +goose Down
+DROP INDEX chat_dialog_users_idx;
+
+ALTER TABLE chat DROP COLUMN dialog_user2;
+ALTER TABLE chat DROP COLUMN dialog_user1;
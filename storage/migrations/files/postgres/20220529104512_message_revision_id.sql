@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- revisions made within the same clock tick are ordered by id
+ALTER TABLE message_revision ADD COLUMN id bigserial PRIMARY KEY;
+
+
+
+-- +goose Down
+ALTER TABLE message_revision DROP COLUMN id;
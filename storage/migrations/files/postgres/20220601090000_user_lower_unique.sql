@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- usernames and emails are unique regardless of case
+DROP INDEX IF EXISTS user_username_idx;
+DROP INDEX IF EXISTS user_email_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_username_idx ON "user" (lower(username));
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_idx ON "user" (lower(email));
+
+
+
+-- +goose Down
+DROP INDEX IF EXISTS user_username_idx;
+DROP INDEX IF EXISTS user_email_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_username_idx ON "user" (username);
+CREATE UNIQUE INDEX IF NOT EXISTS user_email_idx ON "user" (email);
@@ -0,0 +1,16 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS message (
+    id text PRIMARY KEY,
+    chat_id text NOT NULL,
+    user_id text NOT NULL,
+    body text NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS message_chat_id_id_idx ON message (chat_id, id);
+
+
+
+-- +goose Down
+DROP TABLE message;
@@ -0,0 +1,21 @@
+-- +goose Up
+
+ALTER TABLE message ADD COLUMN edited_at timestamp;
+ALTER TABLE message ADD COLUMN deleted_at timestamp;
+
+CREATE TABLE IF NOT EXISTS message_revision (
+    message_id text NOT NULL,
+    editor_id text NOT NULL,
+    body text NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS message_revision_message_id_idx ON message_revision (message_id, created_at);
+
+
+
+-- +goose Down
+DROP TABLE message_revision;
+
+ALTER TABLE message DROP COLUMN deleted_at;
+ALTER TABLE message DROP COLUMN edited_at;
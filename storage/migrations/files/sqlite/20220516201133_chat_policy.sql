@@ -0,0 +1,8 @@
+-- +goose Up
+
+ALTER TABLE chat ADD COLUMN policy text;
+
+
+
+-- +goose Down
+ALTER TABLE chat DROP COLUMN policy;
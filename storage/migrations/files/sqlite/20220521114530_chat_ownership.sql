@@ -0,0 +1,21 @@
+-- +goose Up
+
+ALTER TABLE member ADD COLUMN joined_at timestamp;
+UPDATE member SET joined_at = CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS ownership_change (
+    chat_id text NOT NULL,
+    from_user_id text,
+    to_user_id text,
+    reason text NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ownership_change_chat_id_idx ON ownership_change (chat_id, created_at);
+
+
+
+-- +goose Down
+DROP TABLE ownership_change;
+
+ALTER TABLE member DROP COLUMN joined_at;
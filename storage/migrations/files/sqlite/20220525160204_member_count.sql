@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- shards of member counters added to chat.num_members, so that joins of channels
+-- do not all update the chat row
+CREATE TABLE IF NOT EXISTS member_count (
+    chat_id text,
+    shard int,
+    delta int NOT NULL,
+    primary key (chat_id, shard)
+);
+
+
+
+-- +goose Down
+DROP TABLE member_count;
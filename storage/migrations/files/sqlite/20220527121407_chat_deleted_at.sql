@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- deleted chats are purged when their grace period expires
+CREATE INDEX IF NOT EXISTS chat_deleted_at_idx ON chat (deleted_at) WHERE deleted_at IS NOT NULL;
+
+
+
+-- +goose Down
+DROP INDEX chat_deleted_at_idx;
@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- revisions made within the same clock tick are ordered by id,
+-- sqlite can not add a serial column so the table is recreated
+CREATE TABLE message_revision_new (
+    id integer PRIMARY KEY,
+    message_id text NOT NULL,
+    editor_id text NOT NULL,
+    body text NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+INSERT INTO message_revision_new (message_id, editor_id, body, created_at)
+SELECT message_id, editor_id, body, created_at FROM message_revision ORDER BY created_at, rowid;
+
+DROP TABLE message_revision;
+ALTER TABLE message_revision_new RENAME TO message_revision;
+
+CREATE INDEX IF NOT EXISTS message_revision_message_id_idx ON message_revision (message_id, created_at);
+
+
+
+-- +goose Down
+CREATE TABLE message_revision_old (
+    message_id text NOT NULL,
+    editor_id text NOT NULL,
+    body text NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+INSERT INTO message_revision_old (message_id, editor_id, body, created_at)
+SELECT message_id, editor_id, body, created_at FROM message_revision ORDER BY id;
+
+DROP TABLE message_revision;
+ALTER TABLE message_revision_old RENAME TO message_revision;
+
+CREATE INDEX IF NOT EXISTS message_revision_message_id_idx ON message_revision (message_id, created_at);
@@ -3,21 +3,23 @@ package migrations
 import (
 	"database/sql"
 	"embed"
+	"path"
 
 	"github.com/pressly/goose/v3"
 )
 
-//go:embed files/*.sql
+//go:embed files/postgres/*.sql files/sqlite/*.sql
 var embedMigrations embed.FS
 
-func Migrate(db *sql.DB) error {
+// Migrate applies migrations of the given dialect ("postgres" or "sqlite").
+func Migrate(db *sql.DB, dialect string) error {
 
 	goose.SetBaseFS(embedMigrations)
 
-	if err := goose.SetDialect("postgres"); err != nil {
+	if err := goose.SetDialect(dialect); err != nil {
 		return err
 	}
-	if err := goose.Up(db, "files"); err != nil {
+	if err := goose.Up(db, path.Join("files", dialect)); err != nil {
 		return err
 	}
 
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// Tables lists the tables created by the migrations, new tables must be added here.
+var Tables = []string{
+	"message_revision",
+	"message",
+	"member_count",
+	"ownership_change",
+	"chat_role",
+	"member",
+	"chat",
+	"user",
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Truncate deletes all rows from the tables of the migrations.
+func Truncate(db execer) error {
+
+	const op = "Truncate"
+
+	for _, table := range Tables {
+		if _, err := db.Exec(`DELETE FROM "` + table + `"`); err != nil {
+			return errors.Wrapf(err, "%s: %s", op, table)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package migrations_test
+
+import (
+	"testing"
+
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/migrations"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTables(t *testing.T) {
+
+	db := storagetest.Connect(t, storage.SQLite)
+
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'goose_db_version'`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		tables = append(tables, name)
+	}
+	require.NoError(t, rows.Err())
+
+	assert.ElementsMatch(t, tables, migrations.Tables, "all tables must be truncated")
+}
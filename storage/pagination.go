@@ -0,0 +1,41 @@
+package storage
+
+import (
+	sq "github.com/Masterminds/squirrel"
+	"github.com/alenapetraki/chat/util"
+)
+
+// Paginate orders the query by the unique key column and limits it to the page
+// described by options, fetching one extra row for util.NewPage.
+// Offset is only applied without a cursor.
+func Paginate(query sq.SelectBuilder, column string, desc bool, options *util.PaginationOptions, keyset *util.Keyset) sq.SelectBuilder {
+
+	// listing backward is listing forward in reverse order
+	reverse := desc
+	if keyset != nil && keyset.Backward {
+		reverse = !reverse
+	}
+
+	if keyset != nil {
+		if reverse {
+			query = query.Where(sq.Lt{column: keyset.Key})
+		} else {
+			query = query.Where(sq.Gt{column: keyset.Key})
+		}
+	}
+
+	if reverse {
+		query = query.OrderBy(column + " DESC")
+	} else {
+		query = query.OrderBy(column)
+	}
+
+	if options != nil && options.Limit != 0 {
+		query = query.Limit(uint64(options.Limit) + 1)
+		if keyset == nil {
+			query = query.Offset(uint64(options.Offset))
+		}
+	}
+
+	return query
+}
@@ -0,0 +1,54 @@
+// Package storagetest connects storage test suites to the test databases.
+//
+// SQLite is always used. Postgres is used as well when CHAT_TEST_POSTGRES is set,
+// it expects the database from docker-compose.yml to be running.
+package storagetest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/migrations"
+)
+
+func Drivers() []string {
+	drivers := []string{storage.SQLite}
+	if os.Getenv("CHAT_TEST_POSTGRES") != "" {
+		drivers = append(drivers, storage.Postgres)
+	}
+	return drivers
+}
+
+// Connect returns a migrated database which is closed at the end of the test.
+func Connect(t *testing.T, driver string) storage.DB {
+
+	config := &storage.Config{
+		Host:     "localhost",
+		Port:     "5435",
+		User:     "chat_user",
+		Password: "chat_password",
+		Database: "chat",
+	}
+	if driver == storage.SQLite {
+		config = &storage.Config{Database: filepath.Join(t.TempDir(), "chat.db")}
+	}
+
+	db, err := storage.Connect(driver, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return storage.NewDB(db, driver)
+}
+
+// Truncate empties all tables, Postgres databases are shared between tests.
+func Truncate(t testing.TB, db storage.DB) {
+	if err := migrations.Truncate(db); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	maxTxRetries       = 3
+	txRetryBaseBackoff = 20 * time.Millisecond
+	txRetryMaxBackoff  = 500 * time.Millisecond
+)
+
+// TxOptions are options of a top level transaction, nil options mean the database defaults.
+// Nested transactions share options of the top level one.
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
+func (o *TxOptions) sqlOptions() *sql.TxOptions {
+	if o == nil {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+}
+
+// txRetryBackoff returns a random delay before the attempt, growing exponentially.
+func txRetryBackoff(attempt int) time.Duration {
+	backoff := txRetryBaseBackoff << (attempt - 1)
+	if backoff > txRetryMaxBackoff {
+		backoff = txRetryMaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Transaction is a database transaction. Transactions begun on a transaction are nested
+// ones implemented with savepoints: committing a nested transaction releases its savepoint
+// and rolling it back undoes only its changes.
+type Transaction struct {
+	tx     *sql.Tx
+	driver string
+	// savepoint is the name of a nested transaction savepoint.
+	savepoint string
+	depth     int
+}
+
+func (t *Transaction) Driver() string {
+	return t.driver
+}
+
+func (t *Transaction) Builder() sq.StatementBuilderType {
+	return builder(t.driver)
+}
+
+func (t *Transaction) Exec(sql string, args ...interface{}) (sql.Result, error) {
+	return t.tx.Exec(sql, args...)
+}
+
+func (t *Transaction) Query(sql string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.Query(sql, args...)
+}
+
+func (t *Transaction) QueryRow(sql string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRow(sql, args...)
+}
+
+func (t *Transaction) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, sql, args...)
+}
+
+func (t *Transaction) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, sql, args...)
+}
+
+func (t *Transaction) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRowContext(ctx, sql, args...)
+}
+
+func (t *Transaction) Commit() error {
+	if t.savepoint != "" {
+		_, err := t.tx.Exec("RELEASE SAVEPOINT " + t.savepoint)
+		return err
+	}
+	return t.tx.Commit()
+}
+
+func (t *Transaction) Rollback() error {
+	if t.savepoint != "" {
+		if _, err := t.tx.Exec("ROLLBACK TO SAVEPOINT " + t.savepoint); err != nil {
+			return err
+		}
+		_, err := t.tx.Exec("RELEASE SAVEPOINT " + t.savepoint)
+		return err
+	}
+	return t.tx.Rollback()
+}
+
+// Begin starts a nested transaction, opts are ignored.
+func (t *Transaction) Begin(ctx context.Context, _ *TxOptions) (*Transaction, error) {
+	savepoint := fmt.Sprintf("sp_%d", t.depth+1)
+	if _, err := t.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, err
+	}
+	return &Transaction{tx: t.tx, driver: t.driver, savepoint: savepoint, depth: t.depth + 1}, nil
+}
+
+// RunTx runs fn in a nested transaction. It is not retried: a serialization failure
+// aborts the top level transaction, which is retried as a whole.
+func (t *Transaction) RunTx(ctx context.Context, opts *TxOptions, fn func(tx *Transaction) error) error {
+	return runTx(ctx, t, opts, fn)
+}
+
+func runTx(ctx context.Context, db DB, opts *TxOptions, fn func(tx *Transaction) error) (err error) {
+	tx, err := db.Begin(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		switch {
+		case p != nil:
+			// a panic occurred, rollback and repanic
+			_ = tx.Rollback()
+			panic(p)
+		case err != nil:
+			// something went wrong, rollback
+			_ = tx.Rollback()
+		default:
+			// all good, commit
+			err = tx.Commit()
+		}
+	}()
+	return fn(tx)
+}
@@ -0,0 +1,138 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunTx(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			testRunTx(t, storagetest.Connect(t, driver))
+		})
+	}
+}
+
+func testRunTx(t *testing.T, db storage.DB) {
+
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, "CREATE TABLE tx_test (id int)")
+	require.NoError(t, err)
+
+	insert := func(tx storage.DB, id int) error {
+		_, err := tx.Builder().Insert("tx_test").Columns("id").Values(id).RunWith(tx).ExecContext(ctx)
+		return err
+	}
+	ids := func() []int {
+		rows, err := db.QueryContext(ctx, "SELECT id FROM tx_test ORDER BY id")
+		require.NoError(t, err)
+		defer rows.Close()
+		res := make([]int, 0)
+		for rows.Next() {
+			var id int
+			require.NoError(t, rows.Scan(&id))
+			res = append(res, id)
+		}
+		return res
+	}
+
+	errFailed := errors.New("failed")
+
+	t.Run("nested", func(t *testing.T) {
+		err := db.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+			if err := insert(tx, 1); err != nil {
+				return err
+			}
+			if err := tx.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+				return insert(tx, 2)
+			}); err != nil {
+				return err
+			}
+
+			err := tx.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+				if err := insert(tx, 3); err != nil {
+					return err
+				}
+				// вложенная в откатываемую транзакция откатывается вместе с ней
+				if err := tx.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+					return insert(tx, 4)
+				}); err != nil {
+					return err
+				}
+				return errFailed
+			})
+			require.ErrorIs(t, err, errFailed)
+
+			assert.Panics(t, func() {
+				_ = tx.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+					_ = insert(tx, 5)
+					panic("boom")
+				})
+			})
+
+			return insert(tx, 6)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 6}, ids())
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		_, err := db.ExecContext(ctx, "DELETE FROM tx_test")
+		require.NoError(t, err)
+
+		attempts := 0
+		err = db.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+			attempts++
+			if err := insert(tx, attempts); err != nil {
+				return err
+			}
+			if attempts < 3 {
+				return errors.Wrap(&pq.Error{Code: "40001"}, "op")
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, []int{3}, ids(), "Неудачные попытки должны быть откачены")
+
+		attempts = 0
+		err = db.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+			attempts++
+			return &pq.Error{Code: "40P01"}
+		})
+		assert.True(t, storage.IsSerializationFailure(err))
+		assert.Equal(t, 4, attempts, "Число повторов ограничено")
+
+		attempts = 0
+		err = db.RunTx(ctx, nil, func(tx *storage.Transaction) error {
+			attempts++
+			return errFailed
+		})
+		assert.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		err := db.RunTx(ctx, &storage.TxOptions{Isolation: sql.LevelSerializable}, func(tx *storage.Transaction) error {
+			return nil
+		})
+		assert.NoError(t, err)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		err = db.RunTx(cancelled, nil, func(tx *storage.Transaction) error {
+			t.Fatal("must not be called")
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,172 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/users"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/pkg/errors"
+)
+
+type Storage struct {
+	storage.DB
+}
+
+func New(db storage.DB) *Storage {
+	return &Storage{DB: db}
+}
+
+// user is a reserved word in postgres
+const userTable = `"user"`
+
+func (s *Storage) CreateUser(ctx context.Context, user *entities.User) error {
+	const op = "Storage.CreateUser"
+
+	_, err := s.Builder().Insert(userTable).
+		Columns("id", "username", "password_hash", "email", "full_name", "status").
+		Values(user.ID, user.Username, user.Password, user.Email, user.FullName, user.Status).
+		RunWith(s.DB).ExecContext(ctx)
+	if err != nil {
+		if storage.IsUniqueViolation(err) {
+			err = users.ErrAlreadyExists
+		}
+		return errors.Wrap(err, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetUser(ctx context.Context, userID string) (*entities.User, error) {
+	const op = "Storage.GetUser"
+
+	user, err := s.getUser(ctx, sq.Eq{"id": userID})
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return user, nil
+}
+
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*entities.User, error) {
+	const op = "Storage.GetUserByUsername"
+
+	// usernames are unique regardless of case, see the user_username_idx index
+	user, err := s.getUser(ctx, sq.Expr("lower(username) = lower(?)", username))
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	return user, nil
+}
+
+// GetUsers returns existing users with the given ids in no particular order.
+func (s *Storage) GetUsers(ctx context.Context, userIDs []string) ([]*entities.User, error) {
+	const op = "Storage.GetUsers"
+
+	rows, err := s.Builder().Select("id", "username", "password_hash", "email", "full_name", "status").
+		From(userTable).
+		Where(sq.Eq{"id": userIDs}).
+		RunWith(s.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, op)
+	}
+	defer rows.Close()
+
+	res := make([]*entities.User, 0, len(userIDs))
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, op)
+		}
+		res = append(res, user)
+	}
+
+	return res, errors.Wrap(rows.Err(), op)
+}
+
+func (s *Storage) getUser(ctx context.Context, where sq.Sqlizer) (*entities.User, error) {
+
+	row := s.Builder().Select("id", "username", "password_hash", "email", "full_name", "status").
+		From(userTable).
+		Where(where).
+		RunWith(s.DB).
+		QueryRowContext(ctx)
+
+	user, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = users.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func scanUser(row sq.RowScanner) (*entities.User, error) {
+	var (
+		user             entities.User
+		fullName, status sql.NullString
+	)
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Email,
+		&fullName,
+		&status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	user.FullName = fullName.String
+	user.Status = status.String
+
+	return &user, nil
+}
+
+// UpdateUser updates profile fields of the user. Username and password are not changed.
+func (s *Storage) UpdateUser(ctx context.Context, user *entities.User) error {
+	const op = "Storage.UpdateUser"
+
+	res, err := s.Builder().Update(userTable).
+		Set("email", user.Email).
+		Set("full_name", user.FullName).
+		Set("status", user.Status).
+		Where(sq.Eq{"id": user.ID}).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		if storage.IsUniqueViolation(err) {
+			err = users.ErrAlreadyExists
+		}
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(users.ErrNotFound, op)
+	}
+
+	return nil
+}
+
+func (s *Storage) UpdatePassword(ctx context.Context, userID, password string) error {
+	const op = "Storage.UpdatePassword"
+
+	res, err := s.Builder().Update(userTable).
+		Set("password_hash", password).
+		Where(sq.Eq{"id": userID}).
+		RunWith(s.DB).
+		ExecContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, op)
+	}
+
+	if num, _ := res.RowsAffected(); num == 0 {
+		return errors.Wrap(users.ErrNotFound, op)
+	}
+
+	return nil
+}
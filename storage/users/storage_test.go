@@ -0,0 +1,142 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alenapetraki/chat/entities"
+	"github.com/alenapetraki/chat/services/users"
+	"github.com/alenapetraki/chat/storage"
+	"github.com/alenapetraki/chat/storage/storagetest"
+	"github.com/alenapetraki/chat/util/id"
+	"github.com/stretchr/testify/suite"
+)
+
+type testSuite struct {
+	suite.Suite
+	db storage.DB
+	st *Storage
+}
+
+func TestStorage(t *testing.T) {
+	for _, driver := range storagetest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			suite.Run(t, &testSuite{db: storagetest.Connect(t, driver)})
+		})
+	}
+}
+
+func (t *testSuite) SetupTest() {
+
+	t.st = New(t.db)
+
+	storagetest.Truncate(t.T(), t.db)
+}
+
+func (t *testSuite) TestCreateUser() {
+
+	ctx := context.Background()
+
+	user := &entities.User{
+		ID:       id.MustNewULID(),
+		Username: "alice",
+		Password: "hash",
+		Email:    "alice@test.some",
+		FullName: "Alice",
+	}
+	t.Require().NoError(t.st.CreateUser(ctx, user))
+
+	{
+		res, err := t.st.GetUser(ctx, user.ID)
+		t.Require().NoError(err)
+		t.Assert().Equal(user, res)
+	}
+	{
+		res, err := t.st.GetUserByUsername(ctx, "alice")
+		t.Require().NoError(err)
+		t.Assert().Equal(user.ID, res.ID)
+	}
+	{
+		err := t.st.CreateUser(ctx, &entities.User{
+			ID:       id.MustNewULID(),
+			Username: "alice",
+			Password: "hash",
+			Email:    "other@test.some",
+		})
+		t.Assert().ErrorIs(err, users.ErrAlreadyExists, "Имя пользователя должно быть уникальным")
+	}
+	{
+		err := t.st.CreateUser(ctx, &entities.User{
+			ID:       id.MustNewULID(),
+			Username: "bob",
+			Password: "hash",
+			Email:    "alice@test.some",
+		})
+		t.Assert().ErrorIs(err, users.ErrAlreadyExists, "Email должен быть уникальным")
+	}
+	{
+		err := t.st.CreateUser(ctx, &entities.User{
+			ID:       id.MustNewULID(),
+			Username: "Alice",
+			Password: "hash",
+			Email:    "ALICE@test.some",
+		})
+		t.Assert().ErrorIs(err, users.ErrAlreadyExists, "Уникальность не зависит от регистра")
+	}
+	{
+		res, err := t.st.GetUserByUsername(ctx, "ALICE")
+		t.Require().NoError(err, "Пользователь ищется без учета регистра")
+		t.Assert().Equal(user.ID, res.ID)
+	}
+}
+
+func (t *testSuite) TestUpdateUser() {
+
+	ctx := context.Background()
+
+	user := &entities.User{
+		ID:       id.MustNewULID(),
+		Username: "alice",
+		Password: "hash",
+		Email:    "alice@test.some",
+	}
+	t.Require().NoError(t.st.CreateUser(ctx, user))
+
+	user.FullName = "Alice Liddell"
+	user.Status = "down the rabbit hole"
+	t.Require().NoError(t.st.UpdateUser(ctx, user))
+	t.Require().NoError(t.st.UpdatePassword(ctx, user.ID, "new hash"))
+
+	res, err := t.st.GetUser(ctx, user.ID)
+	t.Require().NoError(err)
+	t.Assert().Equal("Alice Liddell", res.FullName)
+	t.Assert().Equal("down the rabbit hole", res.Status)
+	t.Assert().Equal("new hash", res.Password)
+
+	_, err = t.st.GetUser(ctx, "not_exist")
+	t.Assert().ErrorIs(err, users.ErrNotFound)
+	t.Assert().ErrorIs(t.st.UpdatePassword(ctx, "not_exist", "hash"), users.ErrNotFound)
+}
+
+func (t *testSuite) TestGetUsers() {
+
+	ctx := context.Background()
+
+	ids := make([]string, 3)
+	for i, name := range []string{"alice", "bob", "carol"} {
+		ids[i] = id.MustNewULID()
+		t.Require().NoError(t.st.CreateUser(ctx, &entities.User{
+			ID:       ids[i],
+			Username: name,
+			Password: "hash",
+			Email:    name + "@test.some",
+		}))
+	}
+
+	res, err := t.st.GetUsers(ctx, []string{ids[0], ids[2], "not_exist"})
+	t.Require().NoError(err)
+	t.Require().Len(res, 2)
+
+	names := []string{res[0].Username, res[1].Username}
+	t.Assert().ElementsMatch([]string{"alice", "carol"}, names)
+}
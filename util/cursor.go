@@ -0,0 +1,155 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/alenapetraki/chat/util/errs"
+)
+
+var ErrInvalidCursor = errs.New(errs.InvalidArgument, "invalid cursor")
+
+// cursorSecret signs cursors so that clients cannot forge them. It is random by default,
+// instances serving the same clients must share it with SetCursorSecret.
+var (
+	cursorSecretMu sync.RWMutex
+	cursorSecret   = func() []byte {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		return b
+	}()
+)
+
+func SetCursorSecret(secret []byte) {
+	cursorSecretMu.Lock()
+	defer cursorSecretMu.Unlock()
+	cursorSecret = secret
+}
+
+// Page describes where a listed page is. Cursors are empty if there is nothing to list
+// in their direction.
+type Page struct {
+	NextCursor string
+	PrevCursor string
+	// Total is a number of items in all pages, set by lists which count them.
+	Total int
+}
+
+// Keyset is a position in a list ordered by a unique key, e.g. ULID.
+type Keyset struct {
+	Key string `json:"k"`
+	// Backward lists items preceding the key.
+	Backward bool `json:"b,omitempty"`
+	// Scope identifies the list the key belongs to, see CursorScope.
+	Scope string `json:"s,omitempty"`
+}
+
+// CursorScope identifies a list by its name and parameters, e.g. the chat and the filter,
+// so that its cursors are not accepted by other lists.
+func CursorScope(list string, params ...interface{}) string {
+	payload, _ := json.Marshal(params)
+	sum := sha256.Sum256(append([]byte(list+":"), payload...))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func EncodeCursor(k Keyset) string {
+	payload, _ := json.Marshal(k)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + signCursor(encoded)
+}
+
+func DecodeCursor(cursor string) (*Keyset, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(signCursor(parts[0]))) {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var k Keyset
+	if err := json.Unmarshal(payload, &k); err != nil || k.Key == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &k, nil
+}
+
+func signCursor(s string) string {
+	cursorSecretMu.RLock()
+	defer cursorSecretMu.RUnlock()
+
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Keyset decodes the cursor of the options, it returns nil if there is no cursor.
+// Cursors of other lists than the one of the scope are invalid.
+func (o *PaginationOptions) Keyset(scope string) (*Keyset, error) {
+	if o == nil || o.Cursor == "" {
+		return nil, nil
+	}
+	k, err := DecodeCursor(o.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if k.Scope != scope {
+		return nil, ErrInvalidCursor
+	}
+	return k, nil
+}
+
+// NewPage makes a page of items fetched in keyset order with one extra item
+// to find out whether there are more of them: in list order when listing forward
+// and in reverse order when listing backward. It returns the items in list order.
+// Cursors of the page are bound to the scope of the list.
+func NewPage[T any](items []T, key func(T) string, options *PaginationOptions, keyset *Keyset, scope string) ([]T, *Page) {
+	page := new(Page)
+	backward := keyset != nil && keyset.Backward
+
+	hasMore := false
+	if options != nil && options.Limit != 0 && len(items) > int(options.Limit) {
+		hasMore = true
+		items = items[:options.Limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if options == nil || options.Limit == 0 {
+		return items, page
+	}
+
+	var first, last string
+	if len(items) > 0 {
+		first, last = key(items[0]), key(items[len(items)-1])
+	} else if keyset != nil {
+		first, last = keyset.Key, keyset.Key
+	}
+
+	if backward {
+		if hasMore {
+			page.PrevCursor = EncodeCursor(Keyset{Key: first, Backward: true, Scope: scope})
+		}
+		if last != "" {
+			page.NextCursor = EncodeCursor(Keyset{Key: last, Scope: scope})
+		}
+		return items, page
+	}
+
+	if hasMore {
+		page.NextCursor = EncodeCursor(Keyset{Key: last, Scope: scope})
+	}
+	if (keyset != nil || options.Offset > 0) && first != "" {
+		page.PrevCursor = EncodeCursor(Keyset{Key: first, Backward: true, Scope: scope})
+	}
+	return items, page
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginationOptions_Keyset(t *testing.T) {
+
+	scope := CursorScope("messages", "chat_1")
+	cursor := EncodeCursor(Keyset{Key: "key", Backward: true, Scope: scope})
+
+	k, err := (&PaginationOptions{Cursor: cursor}).Keyset(scope)
+	require.NoError(t, err)
+	assert.Equal(t, &Keyset{Key: "key", Backward: true, Scope: scope}, k)
+
+	_, err = (&PaginationOptions{Cursor: cursor}).Keyset(CursorScope("messages", "chat_2"))
+	assert.ErrorIs(t, err, ErrInvalidCursor, "cursor of another list")
+
+	_, err = (&PaginationOptions{Cursor: cursor + "x"}).Keyset(scope)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "forged cursor")
+
+	k, err = (&PaginationOptions{}).Keyset(scope)
+	require.NoError(t, err)
+	assert.Nil(t, k)
+
+	assert.NotEqual(t, CursorScope("chats", nil), CursorScope("chat_members", nil))
+}
+
+func TestSetCursorSecret(t *testing.T) {
+
+	cursorSecretMu.RLock()
+	secret := cursorSecret
+	cursorSecretMu.RUnlock()
+	defer SetCursorSecret(secret)
+
+	cursor := EncodeCursor(Keyset{Key: "key"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetCursorSecret([]byte("shared secret"))
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = DecodeCursor(cursor)
+		}()
+	}
+	wg.Wait()
+
+	_, err := DecodeCursor(cursor)
+	assert.ErrorIs(t, err, ErrInvalidCursor, "cursors signed with another secret are invalid")
+
+	_, err = DecodeCursor(EncodeCursor(Keyset{Key: "key"}))
+	assert.NoError(t, err)
+}
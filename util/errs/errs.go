@@ -0,0 +1,194 @@
+// Package errs defines typed errors of the domain. Errors have codes which transports
+// map to their statuses, so that callers do not match errors by their messages.
+package errs
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Code string
+
+const (
+	Internal        Code = "internal"
+	InvalidArgument Code = "invalid_argument"
+	NotFound        Code = "not_found"
+	Conflict        Code = "conflict"
+	Forbidden       Code = "forbidden"
+	Unauthenticated Code = "unauthenticated"
+	LimitExceeded   Code = "limit_exceeded"
+)
+
+// Error makes errors match their codes: errors.Is(err, errs.NotFound).
+func (c Code) Error() string {
+	return string(c)
+}
+
+type Error struct {
+	Code    Code
+	Message string
+	// Fields describe invalid fields of InvalidArgument errors.
+	Fields map[string]string
+	// Err is the cause of the error.
+	Err error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap gives the code to err, the message is shown instead of the message of err.
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// Invalid returns an InvalidArgument error about the field.
+func Invalid(field, message string) *Error {
+	return &Error{
+		Code:    InvalidArgument,
+		Message: field + ": " + message,
+		Fields:  map[string]string{field: message},
+	}
+}
+
+// Validation converts errors of ozzo-validation rules to InvalidArgument errors
+// with the fields failed. Internal errors of rules are returned as is.
+func Validation(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(validation.InternalError); ok {
+		return err
+	}
+	e := &Error{Code: InvalidArgument, Message: err.Error(), Err: err}
+	if fields, ok := err.(validation.Errors); ok {
+		e.Fields = make(map[string]string, len(fields))
+		for name, err := range fields {
+			e.Fields[name] = err.Error()
+		}
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil && e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	code, ok := target.(Code)
+	return ok && code == e.Code
+}
+
+// GRPCStatus converts the error to a status with its fields as bad request details.
+func (e *Error) GRPCStatus() *status.Status {
+	st := status.New(e.Code.GRPCCode(), e.Error())
+	if len(e.Fields) == 0 {
+		return st
+	}
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	details := new(errdetails.BadRequest)
+	for _, name := range names {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       name,
+			Description: e.Fields[name],
+		})
+	}
+	if withDetails, err := st.WithDetails(details); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// As returns the first typed error of the chain, errors without one are internal.
+func As(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return &Error{Code: Internal, Message: "internal error", Err: err}
+}
+
+// CodeOf returns the code of the error, Internal for errors without one.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	return As(err).Code
+}
+
+func (c Code) HTTPStatus() int {
+	switch c {
+	case InvalidArgument:
+		return http.StatusBadRequest
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict, LimitExceeded:
+		return http.StatusConflict
+	case Forbidden:
+		return http.StatusForbidden
+	case Unauthenticated:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func (c Code) GRPCCode() codes.Code {
+	switch c {
+	case InvalidArgument:
+		return codes.InvalidArgument
+	case NotFound:
+		return codes.NotFound
+	case Conflict:
+		return codes.AlreadyExists
+	case LimitExceeded:
+		return codes.ResourceExhausted
+	case Forbidden:
+		return codes.PermissionDenied
+	case Unauthenticated:
+		return codes.Unauthenticated
+	}
+	return codes.Internal
+}
+
+// HTTPStatus returns the response status of the error.
+func HTTPStatus(err error) int {
+	return CodeOf(err).HTTPStatus()
+}
+
+// GRPCStatus returns the status of the error, internal errors are not described.
+func GRPCStatus(err error) *status.Status {
+	e := As(err)
+	if e == nil {
+		return status.New(codes.OK, "")
+	}
+	if e.Code == Internal {
+		return status.New(codes.Internal, "internal error")
+	}
+	return e.GRPCStatus()
+}
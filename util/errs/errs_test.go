@@ -0,0 +1,102 @@
+package errs
+
+import (
+	"net/http"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+var errTaken = New(Conflict, "name is taken")
+
+func TestError_Is(t *testing.T) {
+
+	err := errors.Wrap(errTaken, "op")
+
+	assert.ErrorIs(t, err, errTaken)
+	assert.ErrorIs(t, err, Conflict)
+	assert.NotErrorIs(t, err, NotFound)
+	assert.NotErrorIs(t, err, New(Conflict, "name is taken"), "sentinels match by identity")
+
+	var e *Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, errTaken, e)
+	assert.Equal(t, Conflict, CodeOf(err))
+
+	cause := errors.New("connection refused")
+	assert.ErrorIs(t, Wrap(cause, Unauthenticated, "no session"), cause)
+	assert.Equal(t, "no session", Wrap(cause, Unauthenticated, "no session").Error())
+}
+
+func TestAs_Internal(t *testing.T) {
+
+	err := errors.Wrap(errors.New("connection refused"), "op")
+
+	e := As(err)
+	assert.Equal(t, Internal, e.Code)
+	assert.Equal(t, "internal error", e.Error())
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(err))
+	assert.Equal(t, codes.Internal, GRPCStatus(err).Code())
+	assert.Equal(t, "internal error", GRPCStatus(err).Message(), "internal errors are not described")
+	assert.Equal(t, Code(""), CodeOf(nil))
+}
+
+func TestValidation(t *testing.T) {
+
+	assert.NoError(t, Validation(nil))
+
+	s := struct {
+		Name string
+		Age  int
+	}{Age: -1}
+	err := Validation(validation.ValidateStruct(&s,
+		validation.Field(&s.Name, validation.Required),
+		validation.Field(&s.Age, validation.Min(0)),
+	))
+	assert.ErrorIs(t, err, InvalidArgument)
+
+	e := As(errors.Wrap(err, "op"))
+	assert.Equal(t, map[string]string{
+		"Name": "cannot be blank",
+		"Age":  "must be no less than 0",
+	}, e.Fields)
+
+	st := GRPCStatus(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	details, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, details.FieldViolations, 2)
+	assert.Equal(t, "Age", details.FieldViolations[0].Field)
+	assert.Equal(t, "Name", details.FieldViolations[1].Field)
+}
+
+func TestCode_Statuses(t *testing.T) {
+
+	cases := []struct {
+		code Code
+		http int
+		grpc codes.Code
+	}{
+		{InvalidArgument, http.StatusBadRequest, codes.InvalidArgument},
+		{NotFound, http.StatusNotFound, codes.NotFound},
+		{Conflict, http.StatusConflict, codes.AlreadyExists},
+		{Forbidden, http.StatusForbidden, codes.PermissionDenied},
+		{Unauthenticated, http.StatusUnauthorized, codes.Unauthenticated},
+		{LimitExceeded, http.StatusConflict, codes.ResourceExhausted},
+		{Internal, http.StatusInternalServerError, codes.Internal},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.code), func(t *testing.T) {
+			err := errors.Wrap(New(c.code, "failed"), "op")
+			assert.Equal(t, c.http, HTTPStatus(err))
+			assert.Equal(t, c.grpc, GRPCStatus(err).Code())
+		})
+	}
+}
@@ -2,14 +2,19 @@ package id
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 )
 
-//var mu sync.Mutex
-//var entropy = ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
+// entropy is shared so that ULIDs generated within the same millisecond
+// are still sortable in order of creation.
+var (
+	mu      sync.Mutex
+	entropy = ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0)
+)
 
 func MustNewULID() string {
 	result, err := NewULID()
@@ -20,9 +25,9 @@ func MustNewULID() string {
 }
 
 func NewULID() (string, error) {
-	//mu.Lock()
-	//defer mu.Unlock()
-	result, err := ulid.New(ulid.Now(), ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0))
+	mu.Lock()
+	defer mu.Unlock()
+	result, err := ulid.New(ulid.Now(), entropy)
 	if err != nil {
 		return "", errors.Wrap(err, "could not generate a new ULID")
 	}
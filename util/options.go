@@ -1,11 +1,34 @@
 package util
 
+import "strings"
+
 type PaginationOptions struct {
 	Limit  uint `json:"limit,omitempty"`
 	Offset uint `json:"offset,omitempty"`
+	// Cursor continues listing from a page returned earlier, Offset is ignored with it.
+	Cursor string `json:"cursor,omitempty"`
 }
 
 type SortOptions struct {
-	Sort []string `json:"sort,omitempty"`
-	//Descending bool     `json:"descending,omitempty"`
+	Sort []SortField `json:"sort,omitempty"`
+}
+
+type SortField struct {
+	Name       string `json:"name"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+// String formats options as a sort spec, see SortFields.Parse.
+func (o *SortOptions) String() string {
+	if o == nil {
+		return ""
+	}
+	fields := make([]string, len(o.Sort))
+	for i, f := range o.Sort {
+		fields[i] = f.Name
+		if f.Descending {
+			fields[i] = "-" + f.Name
+		}
+	}
+	return strings.Join(fields, ",")
 }
@@ -0,0 +1,24 @@
+package util
+
+import (
+	"context"
+	"time"
+)
+
+// RunPeriodically runs the job every interval until the context is done.
+// Errors of the job are passed to onError, if any, and do not stop it.
+func RunPeriodically(ctx context.Context, interval time.Duration, job func(ctx context.Context) error, onError func(err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
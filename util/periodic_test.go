@@ -0,0 +1,37 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPeriodically(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runs, errs int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunPeriodically(ctx, time.Millisecond, func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1) >= 3 {
+				cancel()
+			}
+			return errors.New("failed")
+		}, func(err error) {
+			atomic.AddInt32(&errs, 1)
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job is not stopped")
+	}
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&runs), int32(3))
+	assert.Equal(t, atomic.LoadInt32(&runs), atomic.LoadInt32(&errs), "errors do not stop the job")
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alenapetraki/chat/util/errs"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidSort = errs.New(errs.InvalidArgument, "invalid sort")
+
+// SortFieldError is returned for a sort field which is not allowed, it matches ErrInvalidSort.
+type SortFieldError struct {
+	Field string
+}
+
+func (e *SortFieldError) Error() string {
+	return fmt.Sprintf("unknown sort field '%s'", e.Field)
+}
+
+func (e *SortFieldError) Unwrap() error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: e.Error(),
+		Fields:  map[string]string{"sort": e.Error()},
+		Err:     ErrInvalidSort,
+	}
+}
+
+// SortFields maps fields an entity can be sorted by to columns they are stored in.
+type SortFields map[string]string
+
+// Parse parses a sort spec like "-created_at,name", where "-" sorts the field in descending order.
+// It returns nil options for an empty spec.
+func (f SortFields) Parse(spec string) (*SortOptions, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	options := new(SortOptions)
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		field := SortField{Name: strings.TrimPrefix(s, "-"), Descending: strings.HasPrefix(s, "-")}
+		if field.Name == "" {
+			return nil, errors.Wrapf(ErrInvalidSort, "empty field in '%s'", spec)
+		}
+		options.Sort = append(options.Sort, field)
+	}
+
+	if err := f.Validate(options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// Validate checks that options only have allowed fields, each at most once.
+func (f SortFields) Validate(options *SortOptions) error {
+	if options == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(options.Sort))
+	for _, field := range options.Sort {
+		if _, ok := f[field.Name]; !ok {
+			return &SortFieldError{Field: field.Name}
+		}
+		if seen[field.Name] {
+			return errors.Wrapf(ErrInvalidSort, "duplicate field '%s'", field.Name)
+		}
+		seen[field.Name] = true
+	}
+	return nil
+}
+
+// OrderBy returns ORDER BY clauses of validated options.
+func (f SortFields) OrderBy(options *SortOptions) []string {
+	if options == nil {
+		return nil
+	}
+	res := make([]string, len(options.Sort))
+	for i, field := range options.Sort {
+		res[i] = f[field.Name]
+		if field.Descending {
+			res[i] += " DESC"
+		}
+	}
+	return res
+}
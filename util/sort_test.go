@@ -0,0 +1,53 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortFields_Parse(t *testing.T) {
+
+	fields := SortFields{"created_at": "id", "name": "name"}
+
+	tests := []struct {
+		spec    string
+		want    *SortOptions
+		orderBy []string
+		err     bool
+	}{
+		{spec: "", want: nil},
+		{
+			spec:    "-created_at, name",
+			want:    &SortOptions{Sort: []SortField{{Name: "created_at", Descending: true}, {Name: "name"}}},
+			orderBy: []string{"id DESC", "name"},
+		},
+		{spec: "name,", err: true},
+		{spec: "-", err: true},
+		{spec: "name,-name", err: true},
+		{spec: "password", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			res, err := fields.Parse(tt.spec)
+			if tt.err {
+				assert.ErrorIs(t, err, ErrInvalidSort)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, res)
+			assert.Equal(t, tt.orderBy, fields.OrderBy(res))
+		})
+	}
+
+	_, err := fields.Parse("password")
+	var sortErr *SortFieldError
+	require.ErrorAs(t, err, &sortErr)
+	assert.Equal(t, "password", sortErr.Field)
+
+	res, err := fields.Parse("-created_at,name")
+	require.NoError(t, err)
+	assert.Equal(t, "-created_at,name", res.String())
+}